@@ -5,27 +5,119 @@
 package main
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"time"
 )
 
+// settings is how the time is written to a connection.
+type settings struct {
+	loc      *time.Location
+	layout   string
+	interval time.Duration
+}
+
+// layouts are the names of FORMAT.
+var layouts = map[string]string{
+	"time":        "15:04:05",
+	"kitchen":     time.Kitchen,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc822":      time.RFC822,
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"stamp":       time.Stamp,
+	"stampmilli":  time.StampMilli,
+	"datetime":    time.DateTime,
+}
+
+const minInterval = 10 * time.Millisecond
+
+// wait is the time to wait for the first line of a client.
+var wait = 1 * time.Second
+
+// parseSettings parses the first line of a client such as
+// "TZ=Asia/Tokyo FORMAT=rfc3339 INTERVAL=500ms". Each key is optional.
+// FORMAT is a name of layouts or a layout of the time package without
+// spaces, e.g. "15:04:05.000".
+func parseSettings(line string) (settings, error) {
+	s := settings{time.Local, layouts["time"], 1 * time.Second}
+	for _, f := range strings.Fields(line) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return s, fmt.Errorf("%q is not KEY=VALUE", f)
+		}
+		switch key, v := strings.ToUpper(kv[0]), kv[1]; key {
+		case "TZ":
+			loc, err := time.LoadLocation(v)
+			if err != nil {
+				return s, err
+			}
+			s.loc = loc
+		case "FORMAT":
+			if layout, ok := layouts[strings.ToLower(v)]; ok {
+				s.layout = layout
+			} else if time.Unix(0, 0).UTC().Format(v) != v {
+				s.layout = v
+			} else {
+				return s, fmt.Errorf("unknown format %q", v)
+			}
+		case "INTERVAL":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return s, err
+			}
+			if d < minInterval {
+				return s, fmt.Errorf("interval %v is shorter than %v", d, minInterval)
+			}
+			s.interval = d
+		default:
+			return s, fmt.Errorf("unknown key %q, use TZ, FORMAT or INTERVAL", kv[0])
+		}
+	}
+	return s, nil
+}
+
+// readSettings reads the optional first line from c. Clients which send
+// nothing within wait get the local time as "15:04:05" every second.
+func readSettings(c net.Conn) (settings, error) {
+	c.SetReadDeadline(time.Now().Add(wait))
+	line, err := bufio.NewReader(c).ReadString('\n')
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		line = "" // no complete line
+	}
+	return parseSettings(line)
+}
+
 func handleConn(c net.Conn) {
 	defer c.Close()
+	s, err := readSettings(c)
+	if err != nil {
+		fmt.Fprintf(c, "error: %v\n", err)
+		return
+	}
+	tick := time.NewTicker(s.interval)
+	defer tick.Stop()
 	for {
-		_, err := io.WriteString(c, time.Now().Format("15:04:05\n"))
+		_, err := io.WriteString(c, time.Now().In(s.loc).Format(s.layout)+"\n")
 		if err != nil {
 			return // e.g., client disconnected
 		}
-		time.Sleep(1 * time.Second)
+		<-tick.C
 	}
 }
 
 func main() {
 	var p string
 	flag.StringVar(&p, "port", "8000", "Port number") // Get -port option
+	flag.DurationVar(&wait, "wait", wait, "Time to wait for the first line of settings")
 	flag.Parse()
 	listener, err := net.Listen("tcp", "localhost:"+p)
 	if err != nil {
@@ -0,0 +1,74 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSettings(t *testing.T) {
+	var tests = []struct {
+		line     string
+		zone     string
+		layout   string
+		interval time.Duration
+		err      bool
+	}{
+		{"", "Local", "15:04:05", time.Second, false},
+		{"TZ=Asia/Tokyo FORMAT=rfc3339 INTERVAL=500ms", "Asia/Tokyo", time.RFC3339, 500 * time.Millisecond, false},
+		{"tz=UTC format=Kitchen", "UTC", time.Kitchen, time.Second, false},
+		{"FORMAT=15:04:05.000", "Local", "15:04:05.000", time.Second, false},
+		{"TZ=Mars/Olympus", "", "", 0, true},
+		{"FORMAT=clock", "", "", 0, true},
+		{"INTERVAL=1ms", "", "", 0, true},
+		{"INTERVAL=soon", "", "", 0, true},
+		{"COLOR=red", "", "", 0, true},
+		{"rfc3339", "", "", 0, true},
+	}
+	for _, test := range tests {
+		s, err := parseSettings(test.line)
+		if (err != nil) != test.err {
+			t.Errorf("parseSettings(%q) = %v, Expected error %v", test.line, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if s.loc.String() != test.zone || s.layout != test.layout || s.interval != test.interval {
+			t.Errorf("parseSettings(%q) = %v %q %v, Expected %v %q %v",
+				test.line, s.loc, s.layout, s.interval, test.zone, test.layout, test.interval)
+		}
+	}
+}
+
+func TestHandleConn(t *testing.T) {
+	defer func(d time.Duration) { wait = d }(wait)
+	wait = 50 * time.Millisecond
+
+	var tests = []struct {
+		settings string
+		expect   func(string) bool
+	}{
+		{"TZ=UTC FORMAT=rfc3339 INTERVAL=10ms\n", func(s string) bool { return strings.HasSuffix(s, "Z") }},
+		{"FORMAT=clock\n", func(s string) bool { return strings.HasPrefix(s, "error: ") }},
+		// A client sending nothing gets the default.
+		{"", func(s string) bool { _, err := time.Parse("15:04:05", s); return err == nil }},
+	}
+	for _, test := range tests {
+		server, client := net.Pipe()
+		go handleConn(server)
+		if test.settings != "" {
+			client.Write([]byte(test.settings))
+		}
+		r := bufio.NewScanner(client)
+		for i := 0; i < 2 && r.Scan(); i++ {
+			if !test.expect(r.Text()) {
+				t.Errorf("Result = %q for %q", r.Text(), test.settings)
+			}
+		}
+		client.Close()
+	}
+}
@@ -17,20 +17,26 @@ var stderr io.Writer = os.Stderr // modified during testing
 
 type clock struct {
 	name, hostport string
+	zone           string // time zone requested to the server, "" for its local time
 	conn           net.Conn
 	time           chan string
 }
 
 func main() {
 	if len(os.Args) == 1 {
-		fmt.Fprintln(stderr, "Needs input \"NAME=HOST:PORT\" at least one.")
+		fmt.Fprintln(stderr, "Needs input \"NAME=HOST:PORT[@ZONE]\" at least one.")
 		return
 	}
 	var clocks []*clock
 	var labels string
 	for _, arg := range os.Args[1:] {
-		data := strings.Split(arg, "=")
-		clocks = append(clocks, &clock{name: data[0], hostport: data[1], conn: nil, time: make(chan string)})
+		data := strings.SplitN(arg, "=", 2)
+		hostport := strings.SplitN(data[1], "@", 2)
+		c := &clock{name: data[0], hostport: hostport[0], conn: nil, time: make(chan string)}
+		if len(hostport) == 2 {
+			c.zone = hostport[1]
+		}
+		clocks = append(clocks, c)
 	}
 	for _, c := range clocks {
 		conn, err := net.Dial("tcp", c.hostport)
@@ -38,6 +44,15 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		// The first line tells clock2 the time zone. An empty line asks
+		// for the local time of the server without waiting.
+		settings := "\n"
+		if c.zone != "" {
+			settings = "TZ=" + c.zone + "\n"
+		}
+		if _, err := io.WriteString(conn, settings); err != nil {
+			log.Fatal(err)
+		}
 		labels += c.name + "\t"
 		go updateTime(c)
 	}
@@ -0,0 +1,433 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+
+// Package client provides an FTP client which talks with the server of
+// ch08/ex02 and other servers implementing RFC 959, RFC 2428 and RFC 3659.
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of dialing and waiting for data connections.
+const DefaultTimeout = 30 * time.Second
+
+// Error is the negative reply of the server.
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%03d %s", e.Code, e.Msg)
+}
+
+// Conn is a control connection to an FTP server. It is not safe for
+// concurrent use.
+type Conn struct {
+	text *textproto.Conn
+	conn net.Conn
+
+	// Active uses PORT/EPRT instead of PASV/EPSV for data connections.
+	Active bool
+	// Timeout of data connections, DefaultTimeout if zero.
+	Timeout time.Duration
+
+	noEPSV bool // the server doesn't support EPSV
+	noEPRT bool // the server doesn't support EPRT
+}
+
+// Dial connects to the server at addr and reads the greeting.
+func Dial(addr string) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{text: textproto.NewConn(conn), conn: conn}
+	if _, _, err := c.response(2); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Cmd sends the command and reads the reply. The reply of multiple lines is
+// joined by "\n". err is *Error if the code doesn't start with expectCode,
+// see textproto.Reader.ReadResponse.
+func (c *Conn) Cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.response(expectCode)
+}
+
+// response reads the reply, converting *textproto.Error to *Error.
+func (c *Conn) response(expectCode int) (int, string, error) {
+	code, msg, err := c.text.ReadResponse(expectCode)
+	if e, ok := err.(*textproto.Error); ok {
+		return code, msg, &Error{Code: e.Code, Msg: e.Msg}
+	}
+	return code, msg, err
+}
+
+// Login logs in with USER and PASS, and switches to TYPE I so that files
+// are transferred as they are.
+func (c *Conn) Login(user, password string) error {
+	code, _, err := c.Cmd(0, "USER %s", user)
+	switch {
+	case err != nil:
+		return err
+	case code == 331:
+		if _, _, err = c.Cmd(2, "PASS %s", password); err != nil {
+			return err
+		}
+	case code != 230:
+		return &Error{Code: code, Msg: "USER not accepted"}
+	}
+	_, _, err = c.Cmd(2, "TYPE I")
+	return err
+}
+
+// Quit sends QUIT and closes the connection.
+func (c *Conn) Quit() error {
+	_, _, err := c.Cmd(2, "QUIT")
+	c.text.Close()
+	return err
+}
+
+// Close closes the connection without QUIT.
+func (c *Conn) Close() error {
+	return c.text.Close()
+}
+
+// Noop sends NOOP to keep the session alive.
+func (c *Conn) Noop() error {
+	_, _, err := c.Cmd(2, "NOOP")
+	return err
+}
+
+// Pwd returns the current directory.
+func (c *Conn) Pwd() (string, error) {
+	_, msg, err := c.Cmd(257, "PWD")
+	if err != nil {
+		return "", err
+	}
+	return unquotePath(msg)
+}
+
+// unquotePath returns the path of 257 reply such as `"/a ""b""" is current directory.`
+func unquotePath(msg string) (string, error) {
+	if !strings.HasPrefix(msg, `"`) {
+		return "", fmt.Errorf("invalid 257 reply: %q", msg)
+	}
+	var b strings.Builder
+	for i := 1; i < len(msg); i++ {
+		if msg[i] != '"' {
+			b.WriteByte(msg[i])
+			continue
+		}
+		if i+1 < len(msg) && msg[i+1] == '"' {
+			b.WriteByte('"')
+			i++
+			continue
+		}
+		return b.String(), nil
+	}
+	return "", fmt.Errorf("invalid 257 reply: %q", msg)
+}
+
+// Cwd changes the current directory.
+func (c *Conn) Cwd(dir string) error {
+	_, _, err := c.Cmd(2, "CWD %s", dir)
+	return err
+}
+
+// CdUp changes the current directory to the parent.
+func (c *Conn) CdUp() error {
+	_, _, err := c.Cmd(2, "CDUP")
+	return err
+}
+
+// Mkdir creates the directory.
+func (c *Conn) Mkdir(dir string) error {
+	_, _, err := c.Cmd(257, "MKD %s", dir)
+	return err
+}
+
+// Rmdir removes the empty directory.
+func (c *Conn) Rmdir(dir string) error {
+	_, _, err := c.Cmd(2, "RMD %s", dir)
+	return err
+}
+
+// Delete removes the file.
+func (c *Conn) Delete(name string) error {
+	_, _, err := c.Cmd(2, "DELE %s", name)
+	return err
+}
+
+// Rename renames from to to with RNFR and RNTO.
+func (c *Conn) Rename(from, to string) error {
+	if _, _, err := c.Cmd(350, "RNFR %s", from); err != nil {
+		return err
+	}
+	_, _, err := c.Cmd(2, "RNTO %s", to)
+	return err
+}
+
+// Size returns the size of the file.
+func (c *Conn) Size(name string) (int64, error) {
+	_, msg, err := c.Cmd(213, "SIZE %s", name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// ModTime returns the modification time of the file.
+func (c *Conn) ModTime(name string) (time.Time, error) {
+	_, msg, err := c.Cmd(213, "MDTM %s", name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse("20060102150405", strings.TrimSpace(msg))
+}
+
+// Retr returns the content of the file. The caller must close it before
+// the next command.
+func (c *Conn) Retr(name string) (io.ReadCloser, error) {
+	return c.RetrFrom(name, 0)
+}
+
+// RetrFrom returns the content of the file from offset, so that an
+// interrupted download can be resumed.
+func (c *Conn) RetrFrom(name string, offset int64) (io.ReadCloser, error) {
+	conn, err := c.transfer(offset, "RETR %s", name)
+	if err != nil {
+		return nil, err
+	}
+	return &dataConn{Conn: conn, c: c}, nil
+}
+
+// Stor uploads r as the file, replacing it if it exists.
+func (c *Conn) Stor(name string, r io.Reader) error {
+	return c.StorFrom(name, r, 0)
+}
+
+// StorFrom uploads r as the file from offset, so that an interrupted
+// upload can be resumed. r should start from offset of the local file.
+func (c *Conn) StorFrom(name string, r io.Reader, offset int64) error {
+	return c.upload(r, offset, "STOR %s", name)
+}
+
+// Append appends r to the file.
+func (c *Conn) Append(name string, r io.Reader) error {
+	return c.upload(r, 0, "APPE %s", name)
+}
+
+func (c *Conn) upload(r io.Reader, offset int64, format string, args ...interface{}) error {
+	conn, err := c.transfer(offset, format, args...)
+	if err != nil {
+		return err
+	}
+	d := &dataConn{Conn: conn, c: c}
+	if _, err = io.Copy(d, r); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// NameList returns the names in the directory with NLST.
+func (c *Conn) NameList(dir string) ([]string, error) {
+	var names []string
+	err := c.readLines(func(line string) error {
+		names = append(names, line)
+		return nil
+	}, "NLST", dir)
+	return names, err
+}
+
+// dataConn is the data connection of a transfer. Close reads the reply
+// which completes the transfer.
+type dataConn struct {
+	net.Conn
+	c      *Conn
+	closed bool
+}
+
+func (d *dataConn) Close() error {
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	if err := d.Conn.Close(); err != nil {
+		return err
+	}
+	_, _, err := d.c.response(2)
+	return err
+}
+
+// transfer sends the command with a data connection and returns the data
+// connection after the preliminary reply.
+func (c *Conn) transfer(offset int64, format string, args ...interface{}) (net.Conn, error) {
+	if c.Active {
+		return c.activeTransfer(offset, format, args...)
+	}
+	conn, err := c.passive()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.sendTransfer(offset, format, args...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sendTransfer sends REST if offset is positive and the command, and reads
+// the preliminary reply.
+func (c *Conn) sendTransfer(offset int64, format string, args ...interface{}) error {
+	if offset > 0 {
+		if _, _, err := c.Cmd(350, "REST %d", offset); err != nil {
+			return err
+		}
+	}
+	_, _, err := c.Cmd(1, format, args...)
+	return err
+}
+
+// passive opens the data connection with EPSV, or PASV if EPSV is not
+// supported.
+func (c *Conn) passive() (net.Conn, error) {
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	var addr string
+	if !c.noEPSV {
+		code, msg, err := c.Cmd(229, "EPSV")
+		switch {
+		case err == nil:
+			var port int
+			if port, err = parseEPSV(msg); err != nil {
+				return nil, err
+			}
+			addr = net.JoinHostPort(host, strconv.Itoa(port))
+		case code == 500 || code == 502:
+			c.noEPSV = true
+		default:
+			return nil, err
+		}
+	}
+	if c.noEPSV {
+		_, msg, err := c.Cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		if addr, err = parsePASV(msg); err != nil {
+			return nil, err
+		}
+	}
+	return net.DialTimeout("tcp", addr, c.timeout())
+}
+
+// parseEPSV returns the port of "Entering Extended Passive Mode (|||6446|)".
+func parseEPSV(msg string) (int, error) {
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("invalid EPSV reply: %q", msg)
+	}
+	f := strings.Split(msg[start+1:end], msg[start+1:start+2])
+	if len(f) != 5 {
+		return 0, fmt.Errorf("invalid EPSV reply: %q", msg)
+	}
+	port, err := strconv.Atoi(f[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid EPSV reply: %q", msg)
+	}
+	return port, nil
+}
+
+// parsePASV returns the address of "Entering Passive Mode (h1,h2,h3,h4,p1,p2)".
+func parsePASV(msg string) (string, error) {
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid PASV reply: %q", msg)
+	}
+	f := strings.Split(msg[start+1:end], ",")
+	if len(f) != 6 {
+		return "", fmt.Errorf("invalid PASV reply: %q", msg)
+	}
+	var n [6]int
+	for i, s := range f {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || v < 0 || v > 255 {
+			return "", fmt.Errorf("invalid PASV reply: %q", msg)
+		}
+		n[i] = v
+	}
+	ip := fmt.Sprintf("%d.%d.%d.%d", n[0], n[1], n[2], n[3])
+	return net.JoinHostPort(ip, strconv.Itoa(n[4]<<8|n[5])), nil
+}
+
+// activeTransfer listens on the local address of the control connection,
+// sends EPRT, or PORT if EPRT is not supported, and accepts the data
+// connection from the server.
+func (c *Conn) activeTransfer(offset int64, format string, args ...interface{}) (net.Conn, error) {
+	local := c.conn.LocalAddr().(*net.TCPAddr)
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local.IP})
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	if err = c.port(local.IP, port); err != nil {
+		return nil, err
+	}
+	if err = c.sendTransfer(offset, format, args...); err != nil {
+		return nil, err
+	}
+	ln.SetDeadline(time.Now().Add(c.timeout()))
+	conn, err := ln.Accept()
+	if err != nil {
+		// The server gives up connecting and sends the final reply.
+		c.response(2)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// port sends EPRT, or PORT if EPRT is not supported.
+func (c *Conn) port(ip net.IP, port int) error {
+	if !c.noEPRT {
+		proto := 2
+		if ip.To4() != nil {
+			proto = 1
+		}
+		code, _, err := c.Cmd(2, "EPRT |%d|%s|%d|", proto, ip, port)
+		if err == nil || (code != 500 && code != 502) {
+			return err
+		}
+		c.noEPRT = true
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errors.New("PORT doesn't support IPv6")
+	}
+	_, _, err := c.Cmd(2, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	return err
+}
+
+func (c *Conn) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/budougumi0617/gopl/ch08/ex02/ftp"
+)
+
+// startServer serves the memory driver on loopback, and returns a client
+// logged in as alice.
+func startServer(t *testing.T, active bool) *Conn {
+	t.Helper()
+	hash, err := ftp.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := filepath.Join(t.TempDir(), "users.json")
+	conf := fmt.Sprintf(`{"users": [{"name": "alice", "password": %q, "home": "alice", "perm": "rwd"}]}`, hash)
+	if err = os.WriteFile(users, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &ftp.Server{Driver: ftp.MemoryDriver(), Logger: log.New(io.Discard, "", 0)}
+	if s.Users, err = ftp.LoadUsers(users); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+
+	c, err := Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.Active = active
+	if err = c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func retr(t *testing.T, c *Conn, name string, offset int64) string {
+	t.Helper()
+	r, err := c.RetrFrom(name, offset)
+	if err != nil {
+		t.Fatalf("RETR %s: %v", name, err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestClient(t *testing.T) {
+	for _, active := range []bool{false, true} {
+		t.Run(fmt.Sprintf("active=%v", active), func(t *testing.T) {
+			testClient(t, startServer(t, active))
+		})
+	}
+}
+
+func testClient(t *testing.T, c *Conn) {
+	if err := c.Mkdir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Cwd("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := c.Pwd(); err != nil || dir != "/docs" {
+		t.Errorf("Result = %q, %v, Expected /docs", dir, err)
+	}
+	if err := c.Stor("a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// Resume the upload from the 5th byte.
+	if err := c.StorFrom("a.txt", strings.NewReader(", world"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Append("a.txt", strings.NewReader("!")); err != nil {
+		t.Fatal(err)
+	}
+	if s := retr(t, c, "a.txt", 0); s != "hello, world!" {
+		t.Errorf("Result = %q, Expected %q", s, "hello, world!")
+	}
+	if s := retr(t, c, "a.txt", 7); s != "world!" {
+		t.Errorf("Result = %q, Expected %q", s, "world!")
+	}
+	if n, err := c.Size("a.txt"); err != nil || n != 13 {
+		t.Errorf("Result = %d, %v, Expected 13", n, err)
+	}
+	if err := c.Rename("a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CdUp(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.List("docs")
+	if err != nil || len(entries) != 1 || entries[0].Name != "b.txt" || entries[0].Size != 13 {
+		t.Errorf("Result = %+v, %v, Expected b.txt of 13 bytes", entries, err)
+	}
+	if names, err := c.NameList(""); err != nil || len(names) != 1 || names[0] != "docs" {
+		t.Errorf("Result = %q, %v, Expected [docs]", names, err)
+	}
+
+	// Mirror resumes the partial file.
+	local := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(local, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(local, "docs", "b.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mirror("/", local); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(local, "docs", "b.txt")); err != nil || string(b) != "hello, world!" {
+		t.Errorf("Result = %q, %v, Expected %q", b, err, "hello, world!")
+	}
+
+	if err := c.Delete("docs/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("docs/b.txt"); err == nil {
+		t.Errorf("Result = nil, Expected error deleting the deleted file")
+	} else if e, ok := err.(*Error); !ok || e.Code != 550 {
+		t.Errorf("Result = %v, Expected 550", err)
+	}
+	if err := c.Rmdir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientMultiline(t *testing.T) {
+	c := startServer(t, false)
+	code, msg, err := c.Cmd(211, "FEAT")
+	if err != nil || code != 211 {
+		t.Fatalf("Result = %d, %v, Expected 211", code, err)
+	}
+	lines := strings.Split(msg, "\n")
+	if len(lines) < 3 || !strings.Contains(msg, "MLST") || lines[len(lines)-1] != "End" {
+		t.Errorf("Result = %q, Expected the features ending with End", msg)
+	}
+}
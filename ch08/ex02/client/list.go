@@ -0,0 +1,203 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EntryType is the type of Entry.
+type EntryType int
+
+// types of Entry.
+const (
+	EntryFile EntryType = iota
+	EntryDir
+	EntryLink
+)
+
+// Entry is a file in the directory listing.
+type Entry struct {
+	Name string
+	Type EntryType
+	Size int64
+	Time time.Time
+}
+
+// List returns the entries of the directory. It uses MLSD, and falls back
+// to parsing "ls -l" style lines of LIST if the server doesn't support MLSD.
+func (c *Conn) List(dir string) ([]*Entry, error) {
+	var entries []*Entry
+	err := c.readLines(func(line string) error {
+		e, err := parseMLSD(line)
+		if e != nil {
+			entries = append(entries, e)
+		}
+		return err
+	}, "MLSD", dir)
+	if e, ok := err.(*Error); !ok || (e.Code != 500 && e.Code != 502) {
+		return entries, err
+	}
+	entries = nil
+	err = c.readLines(func(line string) error {
+		e, err := parseLIST(line)
+		if e != nil {
+			entries = append(entries, e)
+		}
+		return err
+	}, "LIST", dir)
+	return entries, err
+}
+
+// readLines runs the command with the data connection and calls f for
+// each line of it.
+func (c *Conn) readLines(f func(line string) error, verb, arg string) error {
+	format, args := verb, []interface{}{}
+	if arg != "" {
+		format += " %s"
+		args = append(args, arg)
+	}
+	conn, err := c.transfer(0, format, args...)
+	if err != nil {
+		return err
+	}
+	d := &dataConn{Conn: conn, c: c}
+	s := bufio.NewScanner(d)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if err = f(line); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = s.Err()
+	}
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// parseMLSD parses a line of MLSD such as
+//  type=file;size=1024;modify=20160820123456; a.txt
+// It returns nil for the entries of the directory itself and its parent.
+func parseMLSD(line string) (*Entry, error) {
+	i := strings.Index(line, " ")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid MLSD line: %q", line)
+	}
+	e := &Entry{Name: line[i+1:]}
+	for _, fact := range strings.Split(line[:i], ";") {
+		kv := strings.SplitN(fact, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch v := kv[1]; strings.ToLower(kv[0]) {
+		case "type":
+			switch strings.ToLower(v) {
+			case "cdir", "pdir":
+				return nil, nil
+			case "dir":
+				e.Type = EntryDir
+			case "os.unix=symlink", "os.unix=slink":
+				e.Type = EntryLink
+			}
+		case "size":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MLSD line: %q", line)
+			}
+			e.Size = n
+		case "modify":
+			// The fraction of a second is optional.
+			t, err := time.Parse("20060102150405", strings.SplitN(v, ".", 2)[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid MLSD line: %q", line)
+			}
+			e.Time = t
+		}
+	}
+	return e, nil
+}
+
+// parseLIST parses a line of "ls -l" style LIST such as
+//  -rw-r--r-- 1 ftp ftp         1024 Aug 20 12:34 a.txt
+//  drwxr-xr-x 1 ftp ftp         4096 Aug 20  2015 docs
+// It returns nil for "total" lines and the entries "." and "..".
+func parseLIST(line string) (*Entry, error) {
+	if strings.HasPrefix(line, "total ") {
+		return nil, nil
+	}
+	f := strings.Fields(line)
+	if len(f) < 9 {
+		return nil, fmt.Errorf("invalid LIST line: %q", line)
+	}
+	e := &Entry{}
+	switch line[0] {
+	case 'd':
+		e.Type = EntryDir
+	case 'l':
+		e.Type = EntryLink
+	}
+	size, err := strconv.ParseInt(f[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LIST line: %q", line)
+	}
+	e.Size = size
+	if e.Time, err = lsTime(f[5], f[6], f[7]); err != nil {
+		return nil, fmt.Errorf("invalid LIST line: %q", line)
+	}
+	// The name may contain spaces, so take the rest of the line after the
+	// time field.
+	if e.Name = afterFields(line, 8); e.Name == "" {
+		return nil, fmt.Errorf("invalid LIST line: %q", line)
+	}
+	if e.Type == EntryLink {
+		if i := strings.Index(e.Name, " -> "); i >= 0 {
+			e.Name = e.Name[:i]
+		}
+	}
+	if e.Name == "." || e.Name == ".." {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// afterFields returns the rest of s after n fields separated by white
+// spaces, or "" if s doesn't have more fields.
+func afterFields(s string, n int) string {
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		j := strings.IndexFunc(s, unicode.IsSpace)
+		if j < 0 {
+			return ""
+		}
+		s = s[j:]
+	}
+	return strings.TrimLeftFunc(s, unicode.IsSpace)
+}
+
+// lsTime parses the time fields of "ls -l", "Jan _2 15:04" in the last six
+// months or "Jan _2  2006".
+func lsTime(month, day, yearOrTime string) (time.Time, error) {
+	if strings.Contains(yearOrTime, ":") {
+		t, err := time.Parse("Jan 2 15:04", month+" "+day+" "+yearOrTime)
+		if err != nil {
+			return t, err
+		}
+		now := time.Now()
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, nil
+	}
+	return time.Parse("Jan 2 2006", month+" "+day+" "+yearOrTime)
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMLSD(t *testing.T) {
+	var tests = []struct {
+		line   string
+		expect *Entry
+	}{
+		{"type=file;size=1024;modify=20160820123456;perm=r; a b.txt",
+			&Entry{Name: "a b.txt", Type: EntryFile, Size: 1024, Time: time.Date(2016, 8, 20, 12, 34, 56, 0, time.UTC)}},
+		{"Type=dir;Modify=20160820123456.789; docs",
+			&Entry{Name: "docs", Type: EntryDir, Time: time.Date(2016, 8, 20, 12, 34, 56, 0, time.UTC)}},
+		{"type=OS.unix=symlink; link", &Entry{Name: "link", Type: EntryLink}},
+		{"type=cdir; /pub", nil},
+		{"type=pdir; /", nil},
+	}
+	for _, test := range tests {
+		e, err := parseMLSD(test.line)
+		if err != nil || !equal(e, test.expect) {
+			t.Errorf("Result = %+v, %v, Expected %+v", e, err, test.expect)
+		}
+	}
+	if _, err := parseMLSD("type=file;size=x; a"); err == nil {
+		t.Errorf("Result = nil, Expected error")
+	}
+}
+
+func TestParseLIST(t *testing.T) {
+	var tests = []struct {
+		line   string
+		expect *Entry
+	}{
+		{"-rw-r--r-- 1 ftp ftp         1024 Aug 20  2015 a  b.txt",
+			&Entry{Name: "a  b.txt", Type: EntryFile, Size: 1024, Time: time.Date(2015, 8, 20, 0, 0, 0, 0, time.UTC)}},
+		{"drwxr-xr-x    2 1000     1000         4096 Jan  2  2016 docs",
+			&Entry{Name: "docs", Type: EntryDir, Size: 4096, Time: time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)}},
+		{"lrwxrwxrwx 1 ftp ftp 4 Dec 31  2015 link -> a.txt",
+			&Entry{Name: "link", Type: EntryLink, Size: 4, Time: time.Date(2015, 12, 31, 0, 0, 0, 0, time.UTC)}},
+		{"-rw-r--r--\t1 ftp ftp 1024\tAug 20  2015\ta b.txt",
+			&Entry{Name: "a b.txt", Type: EntryFile, Size: 1024, Time: time.Date(2015, 8, 20, 0, 0, 0, 0, time.UTC)}},
+		{"total 8", nil},
+		{"drwxr-xr-x 1 ftp ftp 0 Jan  2  2016 ..", nil},
+	}
+	for _, test := range tests {
+		e, err := parseLIST(test.line)
+		if err != nil || !equal(e, test.expect) {
+			t.Errorf("Result = %+v, %v, Expected %+v", e, err, test.expect)
+		}
+	}
+	e, err := parseLIST("-rw-r--r-- 1 ftp ftp 1 Aug 20 12:34 a.txt")
+	if err != nil || e.Time.Hour() != 12 || e.Time.Minute() != 34 || e.Time.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("Result = %+v, %v, Expected 12:34 in the last year", e, err)
+	}
+	for _, line := range []string{
+		"-rw-r--r--\t1 ftp ftp 1024 Aug 20 12:34",
+		"-rw-r--r-- 1 ftp ftp 1024 Aug 20 12:34\t",
+		"-rw-r--r-- 1 ftp ftp x Aug 20 12:34 a.txt",
+		"-rw-r--r-- 1 ftp ftp 1024 Aug 32 12:34 a.txt",
+	} {
+		if e, err := parseLIST(line); err == nil {
+			t.Errorf("parseLIST(%q) = %+v, Expected error", line, e)
+		}
+	}
+}
+
+func equal(a, b *Entry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name && a.Type == b.Type && a.Size == b.Size && a.Time.Equal(b.Time)
+}
+
+func TestParsePassive(t *testing.T) {
+	addr, err := parsePASV("Entering Passive Mode (127,0,0,1,195,80).")
+	if err != nil || addr != "127.0.0.1:50000" {
+		t.Errorf("Result = %q, %v, Expected 127.0.0.1:50000", addr, err)
+	}
+	port, err := parseEPSV("Entering Extended Passive Mode (|||50000|)")
+	if err != nil || port != 50000 {
+		t.Errorf("Result = %d, %v, Expected 50000", port, err)
+	}
+	for _, msg := range []string{"Entering Passive Mode (127,0,0,1,195)", "Entering Passive Mode (127,0,0,256,1,1)", "Entering"} {
+		if _, err := parsePASV(msg); err == nil {
+			t.Errorf("parsePASV(%q) Result = nil, Expected error", msg)
+		}
+	}
+	for _, msg := range []string{"Entering Extended Passive Mode (||50000|)", "Entering Extended Passive Mode (|||0|)", "()"} {
+		if _, err := parseEPSV(msg); err == nil {
+			t.Errorf("parseEPSV(%q) Result = nil, Expected error", msg)
+		}
+	}
+}
+
+func TestUnquotePath(t *testing.T) {
+	var tests = []struct {
+		msg    string
+		expect string
+	}{
+		{`"/" is current directory.`, "/"},
+		{`"/a ""b""" created.`, `/a "b"`},
+	}
+	for _, test := range tests {
+		if p, err := unquotePath(test.msg); err != nil || p != test.expect {
+			t.Errorf("Result = %q, %v, Expected %q", p, err, test.expect)
+		}
+	}
+	if _, err := unquotePath(`"/unterminated`); err == nil {
+		t.Errorf("Result = nil, Expected error")
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	var tests = []struct {
+		name   string
+		expect bool
+	}{
+		{"a.txt", true},
+		{"my docs", true},
+		{"..a", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../../.bashrc", false},
+		{"/etc/passwd", false},
+		{`..\..\evil`, false},
+		{"a\x00b", false},
+	}
+	for _, test := range tests {
+		if got := safeName(test.name); got != test.expect {
+			t.Errorf("safeName(%q) = %v, Expected %v", test.name, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package client
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mirror downloads the remote directory into the local directory
+// recursively. Files of the same size are skipped, and shorter local files
+// are resumed with REST, so that an interrupted Mirror can be run again.
+// Symbolic links and entries whose names could lead outside of local, such
+// as "..", are skipped.
+func (c *Conn) Mirror(remote, local string) error {
+	entries, err := c.List(remote)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(local, 0755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !safeName(e.Name) {
+			log.Printf("mirror: skipping %q in %s", e.Name, remote)
+			continue
+		}
+		r, l := path.Join(remote, e.Name), filepath.Join(local, e.Name)
+		switch e.Type {
+		case EntryDir:
+			err = c.Mirror(r, l)
+		case EntryFile:
+			if err = c.fetch(r, l, e.Size); err != nil {
+				err = fmt.Errorf("%s: %v", r, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeName reports whether name from the server is a single path element,
+// so that it can be joined to a local directory.
+func safeName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// fetch downloads the remote file of size to local, resuming it if local
+// is shorter.
+func (c *Conn) fetch(remote, local string, size int64) error {
+	var offset int64
+	if info, err := os.Stat(local); err == nil {
+		if info.Size() == size {
+			return nil
+		}
+		if info.Size() < size {
+			offset = info.Size()
+		}
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(local, flag, 0644)
+	if err != nil {
+		return err
+	}
+	r, err := c.RetrFrom(remote, offset)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
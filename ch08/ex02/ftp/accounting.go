@@ -0,0 +1,179 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// logTransfer writes an entry of the transfer in the xferlog format of
+// wu-ftpd, e.g.
+//  Sat Oct 15 21:57:45 2016 1 127.0.0.1 139979 /alice/rfc959.txt b _ o r alice ftp 0 * c
+// dir is 'o' for RETR and 'i' for STOR and APPE.
+func (fh *ftpHandler) logTransfer(start time.Time, name string, size int64, dir byte, complete bool) {
+	w := fh.srv.TransferLog
+	if w == nil {
+		return
+	}
+	now := time.Now()
+	mode := 'r'
+	if fh.account.anonymous() {
+		mode = 'a'
+	}
+	typ := 'b'
+	if fh.transferType == 'A' {
+		typ = 'a'
+	}
+	status := 'c'
+	if !complete {
+		status = 'i'
+	}
+	name = logField(path.Join("/", fh.account.Home, name))
+	fh.srv.xferMu.Lock()
+	defer fh.srv.xferMu.Unlock()
+	_, err := fmt.Fprintf(w, "%s %d %s %d %s %c _ %c %c %s ftp 0 * %c\n",
+		now.Format(time.ANSIC), int64(now.Sub(start).Seconds()+0.5), fh.remoteIP(),
+		size, name, typ, dir, mode, logField(fh.ident), status)
+	if err != nil {
+		fh.logf("xferlog: %v\n", err)
+	}
+}
+
+// logField returns s as a field of the transfer log. Fields are separated
+// by spaces and entries by newlines, so whitespace and control characters
+// are replaced with '_'. An empty field is "*".
+func logField(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// errQuota is returned by quotaWriter when the upload exceeds the quota.
+var errQuota = errors.New("quota exceeded")
+
+// quotaWriter writes at most left bytes to w.
+type quotaWriter struct {
+	w    io.Writer
+	left int64
+}
+
+func (q *quotaWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= q.left {
+		n, err := q.w.Write(p)
+		q.left -= int64(n)
+		return n, err
+	}
+	n, err := q.w.Write(p[:q.left])
+	q.left -= int64(n)
+	if err == nil {
+		err = errQuota
+	}
+	return n, err
+}
+
+// diskUsage returns the total size of the files under dir.
+func diskUsage(fs Driver, dir string) (int64, error) {
+	infos, err := fs.List(dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, info := range infos {
+		if !info.IsDir() {
+			total += info.Size()
+			continue
+		}
+		n, err := diskUsage(fs, path.Join(dir, info.Name()))
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// rateLimiter is a token bucket which limits the throughput to rate bytes
+// per second. It allows a burst of one second. A nil rateLimiter is unlimited.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil if rate is not positive.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until the bucket has refilled them.
+// The tokens may go negative, so that concurrent callers share the rate.
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+// throttledConn is the data connection limited by the session and the
+// global rate limiters. Reading is uploading, writing is downloading.
+type throttledConn struct {
+	io.ReadWriteCloser
+	up, down []*rateLimiter
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	for _, l := range c.up {
+		l.wait(n)
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	for _, l := range c.down {
+		l.wait(len(p))
+	}
+	return c.ReadWriteCloser.Write(p)
+}
+
+// throttle applies the rate limits to the data connection.
+func (fh *ftpHandler) throttle(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	up, down := fh.srv.limiters()
+	if fh.upLimit == nil && fh.downLimit == nil && up == nil && down == nil {
+		return conn
+	}
+	return &throttledConn{
+		ReadWriteCloser: conn,
+		up:              []*rateLimiter{fh.upLimit, up},
+		down:            []*rateLimiter{fh.downLimit, down},
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotaWriter(t *testing.T) {
+	var tests = []struct {
+		left   int64
+		data   string
+		expect string
+		err    error
+	}{
+		{10, "hello", "hello", nil},
+		{5, "hello", "hello", nil},
+		{3, "hello", "hel", errQuota},
+		{0, "hello", "", errQuota},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		_, err := (&quotaWriter{w: &b, left: test.left}).Write([]byte(test.data))
+		if b.String() != test.expect || err != test.err {
+			t.Errorf("Result = %q, %v, Expected %q, %v", b.String(), err, test.expect, test.err)
+		}
+	}
+}
+
+func TestLogField(t *testing.T) {
+	var tests = []struct {
+		s      string
+		expect string
+	}{
+		{"/pub/a.txt", "/pub/a.txt"},
+		{"/my docs/a\tb.txt", "/my_docs/a_b.txt"},
+		{"guest@example.com 0 /etc/passwd b _ o a x ftp 0 * c\nforged", "guest@example.com_0_/etc/passwd_b___o_a_x_ftp_0_*_c_forged"},
+		{"a\x00b\rc", "a_b_c"},
+		{"", "*"},
+	}
+	for _, test := range tests {
+		if got := logField(test.s); got != test.expect {
+			t.Errorf("logField(%q) = %q, Expected %q", test.s, got, test.expect)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1000)
+	start := time.Now()
+	l.wait(1000) // burst
+	l.wait(100)
+	if d := time.Since(start); d < 80*time.Millisecond || d > time.Second {
+		t.Errorf("Result = %v, Expected about 100ms", d)
+	}
+	if newRateLimiter(0) != nil {
+		t.Errorf("Result = non-nil, Expected nil for unlimited rate")
+	}
+}
+
+// epsv opens a passive data connection with EPSV.
+func epsv(t *testing.T, c *textproto.Conn, addr string) net.Conn {
+	t.Helper()
+	msg := cmd(t, c, 229, "EPSV")
+	var port int
+	if _, err := fmt.Sscanf(msg[strings.Index(msg, "(|||"):], "(|||%d|)", &port); err != nil {
+		t.Fatalf("EPSV %q: %v", msg, err)
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// upload stores data as name and returns the final reply code.
+func upload(t *testing.T, c *textproto.Conn, addr, name, data string) int {
+	t.Helper()
+	conn := epsv(t, c, addr)
+	cmd(t, c, 150, "STOR %s", name)
+	io.WriteString(conn, data)
+	conn.Close()
+	code, _, _ := c.ReadResponse(0)
+	return code
+}
+
+func TestServerQuotaAndTransferLog(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xferlog bytes.Buffer
+	s := &Server{
+		Users: &UserDB{accounts: map[string]*account{
+			"alice": {Name: "alice", Password: hash, Home: "alice", perm: permRead | permWrite, Quota: 10},
+		}},
+		TransferLog: &xferlog,
+	}
+	addr := startServer(t, s)
+	c := dial(t, addr, 220)
+	cmd(t, c, 331, "USER alice")
+	cmd(t, c, 230, "PASS secret")
+	cmd(t, c, 200, "TYPE I")
+
+	if code := upload(t, c, addr, "a.txt", "hello"); code != 226 {
+		t.Errorf("Result = %d, Expected 226", code)
+	}
+	if code := upload(t, c, addr, "b.txt", "hello world"); code != 552 {
+		t.Errorf("Result = %d, Expected 552 over the quota", code)
+	}
+	// Overwriting a.txt frees its 5 bytes.
+	if code := upload(t, c, addr, "a.txt", "0123456789"); code != 226 {
+		t.Errorf("Result = %d, Expected 226", code)
+	}
+	cmd(t, c, 552, "STOR c.txt")
+	cmd(t, c, 221, "QUIT")
+
+	s.xferMu.Lock()
+	lines := strings.Split(strings.TrimSpace(xferlog.String()), "\n")
+	s.xferMu.Unlock()
+	if len(lines) != 3 {
+		t.Fatalf("Result = %q, Expected 3 entries", lines)
+	}
+	for i, expect := range []string{
+		"127.0.0.1 5 /alice/a.txt b _ i r alice ftp 0 * c",
+		"127.0.0.1 5 /alice/b.txt b _ i r alice ftp 0 * i",
+		"127.0.0.1 10 /alice/a.txt b _ i r alice ftp 0 * c",
+	} {
+		if f := strings.Fields(lines[i]); strings.Join(f[6:], " ") != expect {
+			t.Errorf("Result = %q, Expected %q", strings.Join(f[6:], " "), expect)
+		}
+	}
+}
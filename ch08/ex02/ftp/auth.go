@@ -0,0 +1,189 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// perm is a set of permissions granted to an account.
+type perm uint
+
+const (
+	permRead perm = 1 << iota
+	permWrite
+	permDelete
+)
+
+// parsePerm parses permission letters such as "rwd".
+func parsePerm(s string) (perm, error) {
+	var p perm
+	for _, r := range s {
+		switch r {
+		case 'r':
+			p |= permRead
+		case 'w':
+			p |= permWrite
+		case 'd':
+			p |= permDelete
+		default:
+			return 0, fmt.Errorf("unknown permission %q", r)
+		}
+	}
+	return p, nil
+}
+
+// account is a user who can log in to the server.
+type account struct {
+	Name     string `json:"name"`
+	Password string `json:"password"` // hashed by HashPassword
+	Home     string `json:"home"`     // relative to the root of the server
+	Perm     string `json:"perm"`     // any of "r", "w" and "d"
+	Quota    int64  `json:"quota"`    // bytes under the home directory, 0 means unlimited
+	perm     perm
+}
+
+// anonymous reports whether a is the anonymous account.
+func (a *account) anonymous() bool {
+	return anonymousNames[a.Name]
+}
+
+// UserDB is the set of accounts loaded from the config file.
+type UserDB struct {
+	accounts  map[string]*account
+	anonymous *account // nil if anonymous login is disabled
+}
+
+// names accepted as anonymous login.
+var anonymousNames = map[string]bool{"anonymous": true, "ftp": true}
+
+// defaultUsers allows only anonymous read-only login.
+var defaultUsers = &UserDB{
+	accounts:  map[string]*account{},
+	anonymous: &account{Name: "anonymous", perm: permRead},
+}
+
+// LoadUsers reads the user database from JSON file such as
+//  {
+//    "anonymous": {"home": "pub"},
+//    "users": [{"name": "alice", "password": "pbkdf2-sha256$...", "home": "alice", "perm": "rwd", "quota": 1048576}]
+//  }
+// Anonymous login is disabled if "anonymous" is omitted. It is always read-only.
+func LoadUsers(filename string) (*UserDB, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var conf struct {
+		Anonymous *account   `json:"anonymous"`
+		Users     []*account `json:"users"`
+	}
+	if err = json.Unmarshal(b, &conf); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	db := &UserDB{accounts: map[string]*account{}}
+	for _, a := range conf.Users {
+		if a.Name == "" || anonymousNames[a.Name] {
+			return nil, fmt.Errorf("%s: invalid user name %q", filename, a.Name)
+		}
+		if a.perm, err = parsePerm(a.Perm); err != nil {
+			return nil, fmt.Errorf("%s: user %s: %v", filename, a.Name, err)
+		}
+		db.accounts[a.Name] = a
+	}
+	if conf.Anonymous != nil {
+		db.anonymous = &account{Name: "anonymous", Home: conf.Anonymous.Home, perm: permRead}
+	}
+	return db, nil
+}
+
+// authenticate returns the account if name and password are valid.
+func (db *UserDB) authenticate(name, password string) (*account, bool) {
+	if anonymousNames[name] {
+		return db.anonymous, db.anonymous != nil
+	}
+	a, ok := db.accounts[name]
+	if !ok || !checkPassword(a.Password, password) {
+		return nil, false
+	}
+	return a, true
+}
+
+const (
+	hashScheme = "pbkdf2-sha256"
+	hashIter   = 100000
+	hashLen    = 32
+)
+
+// HashPassword returns "pbkdf2-sha256$iter$salt$hash" of the password for
+// the user database.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIter, hashLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%x$%x", hashScheme, hashIter, salt, key), nil
+}
+
+// checkPassword reports whether password matches hashed.
+func checkPassword(hashed, password string) bool {
+	f := strings.Split(hashed, "$")
+	if len(f) != 4 || f[0] != hashScheme {
+		return false
+	}
+	iter, err := strconv.Atoi(f[1])
+	if err != nil {
+		return false
+	}
+	salt, err := hex.DecodeString(f[2])
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(f[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// commands accepted before login.
+var preLoginCmds = map[string]bool{
+	"USER": true,
+	"PASS": true,
+	"QUIT": true,
+	"NOOP": true,
+	"FEAT": true,
+	"AUTH": true,
+	"PBSZ": true,
+	"PROT": true,
+	"SYST": true,
+	"HELP": true,
+	"STAT": true,
+	"OPTS": true,
+}
+
+// loggedIn reports whether the client has been authenticated.
+func (fh *ftpHandler) loggedIn() bool {
+	return fh.account != nil
+}
+
+// can reports whether the authenticated user has permission p.
+func (fh *ftpHandler) can(p perm) bool {
+	return fh.account != nil && fh.account.perm&p == p
+}
@@ -0,0 +1,177 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := HashPassword("secret"); other == hash {
+		t.Errorf("Result = %q, Expected a different salt", other)
+	}
+	var tests = []struct {
+		hashed, password string
+		expect           bool
+	}{
+		{hash, "secret", true},
+		{hash, "Secret", false},
+		{hash, "", false},
+		{"secret", "secret", false},
+		{"sha1$1$00$00", "secret", false},
+		{"pbkdf2-sha256$x$00$00", "secret", false},
+		{"pbkdf2-sha256$1$zz$00", "secret", false},
+		{"pbkdf2-sha256$1$00$", "", false},
+		{"pbkdf2-sha256$0$00$00", "", false},
+	}
+	for _, test := range tests {
+		if got := checkPassword(test.hashed, test.password); got != test.expect {
+			t.Errorf("checkPassword(%q, %q) = %v, Expected %v", test.hashed, test.password, got, test.expect)
+		}
+	}
+}
+
+func TestParsePerm(t *testing.T) {
+	var tests = []struct {
+		s      string
+		expect perm
+		err    bool
+	}{
+		{"", 0, false},
+		{"r", permRead, false},
+		{"rwd", permRead | permWrite | permDelete, false},
+		{"rx", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parsePerm(test.s)
+		if got != test.expect || (err != nil) != test.err {
+			t.Errorf("parsePerm(%q) = %v, %v, Expected %v, error %v", test.s, got, err, test.expect, test.err)
+		}
+	}
+}
+
+func TestLoadUsers(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		conf      string
+		users     int
+		anonymous bool
+		err       bool
+	}{
+		{`{}`, 0, false, false},
+		{`{"anonymous": {"home": "pub"}}`, 0, true, false},
+		{`{"users": [{"name": "alice", "password": "` + hash + `", "home": "alice", "perm": "rw"}]}`, 1, false, false},
+		{`{"users": [{"name": "", "perm": "r"}]}`, 0, false, true},
+		{`{"users": [{"name": "anonymous", "perm": "r"}]}`, 0, false, true},
+		{`{"users": [{"name": "bob", "perm": "x"}]}`, 0, false, true},
+		{`{"users": `, 0, false, true},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		filename := filepath.Join(dir, "users.json")
+		if err := os.WriteFile(filename, []byte(test.conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+		db, err := LoadUsers(filename)
+		if (err != nil) != test.err {
+			t.Errorf("LoadUsers(%s) = %v, Expected error %v", test.conf, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(db.accounts) != test.users || (db.anonymous != nil) != test.anonymous {
+			t.Errorf("LoadUsers(%s) = %d users, anonymous %v, Expected %d, %v",
+				test.conf, len(db.accounts), db.anonymous != nil, test.users, test.anonymous)
+		}
+	}
+	if _, err := LoadUsers(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Result = nil, Expected an error of the missing file")
+	}
+
+	// Only the password of the account is accepted, and anonymous is
+	// always read-only.
+	filename := filepath.Join(dir, "users.json")
+	conf := `{"anonymous": {"home": "pub"}, "users": [{"name": "alice", "password": "` + hash + `", "perm": "rwd"}]}`
+	if err := os.WriteFile(filename, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := LoadUsers(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := db.authenticate("alice", "secret"); !ok || a.perm != permRead|permWrite|permDelete {
+		t.Errorf("Result = %v, %v, Expected alice", a, ok)
+	}
+	if _, ok := db.authenticate("alice", "wrong"); ok {
+		t.Errorf("Result = true, Expected the wrong password to be refused")
+	}
+	if _, ok := db.authenticate("bob", "secret"); ok {
+		t.Errorf("Result = true, Expected the unknown user to be refused")
+	}
+	if a, ok := db.authenticate("ftp", "guest@example.com"); !ok || a.perm != permRead || a.Home != "pub" {
+		t.Errorf("Result = %v, %v, Expected read-only anonymous in pub", a, ok)
+	}
+}
+
+func TestPreLoginCommands(t *testing.T) {
+	addr := startServer(t, &Server{})
+	c := dial(t, addr, 220)
+	var tests = []struct {
+		line string
+		code int
+	}{
+		{"PWD", 530},
+		{"CWD /", 530},
+		{"LIST", 530},
+		{"RETR a.txt", 530},
+		{"STOR a.txt", 530},
+		{"PASV", 530},
+		{"NOOP", 200},
+		{"SYST", 215},
+		{"FEAT", 211},
+		{"PASS secret", 503},
+		{"USER anonymous", 331},
+		{"PASS guest@example.com", 230},
+		{"PWD", 257},
+	}
+	for _, test := range tests {
+		cmd(t, c, test.code, "%s", test.line)
+	}
+}
+
+func TestDiskDriverHome(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	for _, d := range []string{filepath.Join(root, "alice"), filepath.Join(dir, "outside")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tests = []struct {
+		home   string
+		expect string // "" if error
+	}{
+		{"alice", filepath.Join(root, "alice")},
+		{"/alice/", filepath.Join(root, "alice")},
+		{"../outside", ""},
+		{"../..", root},
+	}
+	for _, test := range tests {
+		d, err := DiskDriver(root)(test.home)
+		switch {
+		case test.expect == "" && err == nil:
+			t.Errorf("DiskDriver(%q) = %s, Expected an error", test.home, d.(*localDriver).root)
+		case test.expect != "" && (err != nil || d.(*localDriver).root != test.expect):
+			t.Errorf("DiskDriver(%q) = %v, %v, Expected %s", test.home, d, err, test.expect)
+		}
+	}
+}
@@ -0,0 +1,871 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"bufio"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// define Method Expression.
+type ftpCommand func(*ftpHandler, ...string) string
+
+// each client information.
+type ftpHandler struct {
+	srv             *Server
+	mu              sync.Mutex // guards conn and closing against Server.Shutdown
+	conn            net.Conn
+	closing         bool     // Server is shutting down
+	dataTimedOut    bool     // the data connection timed out in the current command
+	data            net.Conn // data connection of the current command, guarded by mu
+	forceClosed     bool     // closeConn has been called, guarded by mu
+	ip              string   // IP address of the control connection
+	addr            string   // address of the client, or the data port given by PORT or EPRT
+	precmd          string
+	passiveListener net.Listener
+	dataMode        string // "PORT" or "PASV", chosen by the last data port command
+	epsvAll         bool
+	fs              Driver // storage rooted at the home directory
+	cwd             string // virtual working directory
+	quit            bool
+	user            string   // name given by USER
+	account         *account // authenticated identity, nil until PASS succeeds
+	ident           string   // user name in the transfer log, the password for anonymous
+	renameFrom      string   // virtual path given by RNFR
+	tls             bool     // control connection is protected by AUTH TLS
+	pbsz            bool     // PBSZ has been accepted
+	protP           bool     // data connections are protected by PROT P
+	restOffset      int64    // offset given by REST for the next transfer
+	upLimit         *rateLimiter
+	downLimit       *rateLimiter
+	transferType    byte // 'A' or 'I' given by TYPE
+	transferMode    byte // 'S' or 'Z' given by MODE
+	zlevel          int  // compression level of MODE Z given by OPTS MODE Z LEVEL
+}
+
+// map of implemantation command.
+var cmdMap = map[string]ftpCommand{}
+
+func init() {
+	initCmdMap()
+}
+
+// return FTP client
+func newFtpHandler(srv *Server, con net.Conn) *ftpHandler {
+	addr := con.RemoteAddr().String()
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+	return &ftpHandler{srv: srv, conn: con, ip: ip, addr: addr, cwd: "/",
+		upLimit: newRateLimiter(srv.UploadRate), downLimit: newRateLimiter(srv.DownloadRate),
+		transferType: 'I', transferMode: 'S', zlevel: zlib.DefaultCompression}
+}
+
+// start ftp connection.
+func (fh *ftpHandler) execute() {
+	// Reply succeed messages to client.
+	fh.sendmsg("220 Service ready for new user")
+	defer fh.closeConn()
+	defer fh.closePassive()
+	s := bufio.NewScanner(fh.conn)
+	for !fh.quit {
+		if !fh.waitCommand() {
+			fh.sendmsg("421 Service not available, closing control connection.")
+			return
+		}
+		if !s.Scan() {
+			if fh.isClosing() {
+				fh.sendmsg("421 Service not available, closing control connection.")
+			} else if ne, ok := s.Err().(net.Error); ok && ne.Timeout() {
+				fh.sendmsg("421 Idle timeout, closing control connection.")
+			}
+			return
+		}
+		conn := fh.conn
+		inputs := fh.parsetext(s.Text())
+		resp := fh.handle(inputs)
+		// Handlers which reply by themselves return empty string.
+		if resp != "" {
+			fh.sendmsg(resp)
+		}
+		// Control connection was upgraded by AUTH.
+		if fh.conn != conn {
+			s = bufio.NewScanner(fh.conn)
+		}
+	}
+}
+
+// parsetext splits the line into the command verb and the rest of the line,
+// so that file names can contain spaces.
+func (fh *ftpHandler) parsetext(t string) []string {
+	if strings.HasPrefix(strings.ToUpper(t), "PASS ") {
+		fh.logf("Parse text : %q\n", "PASS ****")
+	} else {
+		fh.logf("Parse text : %q\n", t)
+	}
+	msg := strings.SplitN(t, " ", 2)
+	msg[0] = strings.ToUpper(msg[0])
+	if len(msg) == 2 && msg[1] == "" {
+		msg = msg[:1]
+	}
+	return msg
+}
+
+// execute FTP command.
+func (fh *ftpHandler) handle(msg []string) (rsp string) {
+	cmd := fh.getcmd(msg[0])
+	if !fh.loggedIn() && !preLoginCmds[msg[0]] {
+		cmd = (*ftpHandler).notLoggedIn
+	}
+	rsp = cmd(fh, msg[1:]...)
+	fh.precmd = msg[0]
+	if fh.dataTimedOut {
+		fh.dataTimedOut = false
+		fh.quit = true
+		rsp = "421 Data connection timed out, closing control connection."
+	}
+	return
+}
+
+// waitCommand sets the idle timeout before reading the next command.
+// It returns false if Server is shutting down.
+func (fh *ftpHandler) waitCommand() bool {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.closing {
+		return false
+	}
+	fh.conn.SetReadDeadline(time.Now().Add(fh.srv.idleTimeout()))
+	return true
+}
+
+// interrupt makes the session end after the current command.
+func (fh *ftpHandler) interrupt() {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.closing = true
+	// Wake up the session waiting for a command.
+	fh.conn.SetReadDeadline(time.Unix(1, 0))
+}
+
+func (fh *ftpHandler) isClosing() bool {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return fh.closing
+}
+
+// closeConn closes the control connection and the data connection.
+func (fh *ftpHandler) closeConn() {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.forceClosed = true
+	fh.conn.Close()
+	if fh.data != nil {
+		fh.data.Close()
+	}
+}
+
+// setData records conn as the current data connection, so that closeConn
+// can close it. It fails if closeConn has been called.
+func (fh *ftpHandler) setData(conn net.Conn) error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.forceClosed {
+		conn.Close()
+		return errors.New("session is closed")
+	}
+	fh.data = conn
+	return nil
+}
+
+// remoteIP returns IP address of the client. It is that of the control
+// connection even after PORT or EPRT.
+func (fh *ftpHandler) remoteIP() string {
+	return fh.ip
+}
+
+func (fh *ftpHandler) logf(format string, v ...interface{}) {
+	fh.srv.output(3, format, v...)
+}
+
+// get from cmdMap
+func (fh *ftpHandler) getcmd(t string) (cmd ftpCommand) {
+	t = strings.ToUpper(t)
+	fh.logf("Search command : %s\n", t)
+	if c, exist := cmdMap[t]; !exist {
+		cmd = (*ftpHandler).notImpl
+	} else {
+		cmd = c
+	}
+	return
+}
+
+func parseAddr(address string) (string, error) {
+	var a, b, c, d byte
+	var p1, p2 int
+	_, err := fmt.Sscanf(address, "%d,%d,%d,%d,%d,%d", &a, &b, &c, &d, &p1, &p2)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d.%d.%d:%d", a, b, c, d, 256*p1+p2), nil
+}
+
+// initCmdMap sets Method Expression to each command.
+func initCmdMap() {
+	cmdMap["USER"] = (*ftpHandler).handleUSER
+	cmdMap["PASS"] = (*ftpHandler).handlePASS
+	cmdMap["QUIT"] = (*ftpHandler).handleQUIT
+	cmdMap["PWD"] = (*ftpHandler).handlePWD
+	cmdMap["PORT"] = (*ftpHandler).handlePORT
+	cmdMap["TYPE"] = (*ftpHandler).handleTYPE
+	cmdMap["STRU"] = (*ftpHandler).handleSTRU
+	cmdMap["MODE"] = (*ftpHandler).handleMODE
+	cmdMap["RETR"] = (*ftpHandler).handleRETR
+	cmdMap["STOR"] = (*ftpHandler).handleSTOR
+	cmdMap["NOOP"] = (*ftpHandler).handleNOOP
+	cmdMap["CWD"] = (*ftpHandler).handleCWD
+	cmdMap["LIST"] = (*ftpHandler).handleLIST
+	cmdMap["PASV"] = (*ftpHandler).handlePASV
+	cmdMap["EPSV"] = (*ftpHandler).handleEPSV
+	cmdMap["EPRT"] = (*ftpHandler).handleEPRT
+	cmdMap["MKD"] = (*ftpHandler).handleMKD
+	cmdMap["XMKD"] = (*ftpHandler).handleMKD
+	cmdMap["RMD"] = (*ftpHandler).handleRMD
+	cmdMap["XRMD"] = (*ftpHandler).handleRMD
+	cmdMap["DELE"] = (*ftpHandler).handleDELE
+	cmdMap["RNFR"] = (*ftpHandler).handleRNFR
+	cmdMap["RNTO"] = (*ftpHandler).handleRNTO
+	cmdMap["CDUP"] = (*ftpHandler).handleCDUP
+	cmdMap["REST"] = (*ftpHandler).handleREST
+	cmdMap["APPE"] = (*ftpHandler).handleAPPE
+	cmdMap["SIZE"] = (*ftpHandler).handleSIZE
+	cmdMap["MDTM"] = (*ftpHandler).handleMDTM
+	cmdMap["NLST"] = (*ftpHandler).handleNLST
+	cmdMap["MLSD"] = (*ftpHandler).handleMLSD
+	cmdMap["MLST"] = (*ftpHandler).handleMLST
+	cmdMap["FEAT"] = (*ftpHandler).handleFEAT
+	cmdMap["AUTH"] = (*ftpHandler).handleAUTH
+	cmdMap["PBSZ"] = (*ftpHandler).handlePBSZ
+	cmdMap["PROT"] = (*ftpHandler).handlePROT
+	cmdMap["SYST"] = (*ftpHandler).handleSYST
+	cmdMap["HELP"] = (*ftpHandler).handleHELP
+	cmdMap["STAT"] = (*ftpHandler).handleSTAT
+	cmdMap["OPTS"] = (*ftpHandler).handleOPTS
+	cmdMap["SITE"] = (*ftpHandler).handleSITE
+}
+
+// send message to client. Multi-line replies built by multiline are sent line by line.
+func (fh *ftpHandler) sendmsg(s string) {
+	fh.logf("Response: %s\n", s)
+	for _, line := range strings.Split(s, "\n") {
+		io.WriteString(fh.conn, strings.TrimSuffix(line, "\r")+"\r\n")
+	}
+}
+
+// multiline returns the multi-line reply such as
+//  211-Features:
+//   MDTM
+//  211 End
+// Lines between first and last are indented by a space, so that clients
+// never take them as the end of the reply.
+func multiline(code int, first string, lines []string, last string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d-%s\n", code, first)
+	for _, l := range lines {
+		fmt.Fprintf(&b, " %s\n", l)
+	}
+	fmt.Fprintf(&b, "%d %s", code, last)
+	return b.String()
+}
+
+// return another connection
+func (fh *ftpHandler) dataConn() (io.ReadWriteCloser, error) {
+	conn, err := fh.rawDataConn()
+	if err != nil {
+		return nil, err
+	}
+	var rwc io.ReadWriteCloser = conn
+	if fh.protP {
+		if rwc, err = fh.secureDataConn(conn); err != nil {
+			return nil, err
+		}
+	}
+	rwc = fh.throttle(rwc)
+	if fh.transferMode == 'Z' {
+		rwc = &deflateConn{conn: rwc, level: fh.zlevel}
+	}
+	return rwc, nil
+}
+
+// rawDataConn opens the data connection without protection.
+func (fh *ftpHandler) rawDataConn() (conn net.Conn, err error) {
+	defer func() {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			fh.dataTimedOut = true
+		}
+		if err == nil {
+			err = fh.setData(conn)
+		}
+		if err == nil {
+			conn = &timeoutConn{conn, fh.srv.dataTimeout(), &fh.dataTimedOut}
+		}
+	}()
+	switch fh.dataMode {
+	case "PORT":
+		conn, err = net.DialTimeout("tcp", fh.addr, fh.srv.dataTimeout())
+		if err != nil {
+			return nil, err
+		}
+	case "PASV":
+		if fh.passiveListener == nil {
+			return nil, fmt.Errorf("passive listener is already closed")
+		}
+		// A passive listener serves exactly one transfer.
+		defer fh.closePassive()
+		if l, ok := fh.passiveListener.(*net.TCPListener); ok {
+			l.SetDeadline(time.Now().Add(fh.srv.dataTimeout()))
+		}
+		conn, err = fh.acceptPassive()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported previous command")
+	}
+	return conn, nil
+}
+
+func (fh *ftpHandler) notImpl(parms ...string) string {
+	return "502 Command not implemented."
+}
+
+func (fh *ftpHandler) notLoggedIn(parms ...string) string {
+	return "530 Please login with USER and PASS."
+}
+
+// Each below comments are corresponding command and replied codes.
+
+// USER
+//  230
+//  530
+//  500, 501, 421
+//  331, 332
+func (fh *ftpHandler) handleUSER(parms ...string) string {
+	if len(parms) != 1 || parms[0] == "" {
+		return "501 Usage: USER name"
+	}
+	if fh.srv.RequireTLS && !fh.tls {
+		return "530 Please secure the connection with AUTH TLS first."
+	}
+	// USER starts a new login even if already logged in.
+	fh.account = nil
+	fh.user = parms[0]
+	if anonymousNames[fh.user] {
+		return "331 Anonymous login okay, send your email as password."
+	}
+	return "331 User name okay, need password."
+}
+
+// PASS
+//    230
+//    202
+//    530
+//    500, 501, 503, 421
+//    332
+func (fh *ftpHandler) handlePASS(parms ...string) string {
+	if fh.user == "" {
+		return "503 Login with USER first."
+	}
+	if fh.loggedIn() {
+		return "202 Already logged in."
+	}
+	name := fh.user
+	fh.user = ""
+	a, ok := fh.srv.users().authenticate(name, strings.Join(parms, " "))
+	if !ok {
+		fh.logf("Login failed %q from %v\n", name, fh.conn.RemoteAddr())
+		return "530 Login incorrect."
+	}
+	fs, err := fh.srv.driver()(a.Home)
+	if err != nil {
+		fh.logf("Home directory of %q is unavailable: %v\n", name, err)
+		return "530 Home directory unavailable."
+	}
+	fh.user = name
+	fh.account = a
+	fh.ident = name
+	if a.anonymous() && len(parms) > 0 {
+		fh.ident = parms[0]
+	}
+	fh.fs = fs
+	fh.cwd = "/"
+	fh.logf("Login %q from %v\n", name, fh.conn.RemoteAddr())
+	return "230 User logged in, proceed."
+}
+
+// QUIT
+//    221
+//    500
+func (fh *ftpHandler) handleQUIT(parms ...string) string {
+	fh.closePassive()
+	fh.quit = true
+	return "221 Service closing control connection. Logged out if appropriate."
+}
+
+// PWD
+//    257
+//    500, 501, 502, 421, 550
+func (fh *ftpHandler) handlePWD(parms ...string) string {
+	fh.logf("Execute PWD %q\n", fh.conn.RemoteAddr())
+	return "257 " + quotePath(fh.cwd) + " is current directory."
+}
+
+// PORT
+//    200Ø
+//    500, 501, 421, 530
+func (fh *ftpHandler) handlePORT(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 Usage: PORT a,b,c,d,p1,p2"
+	}
+	if fh.epsvAll {
+		return "501 PORT not allowed after EPSV ALL."
+	}
+	addr, err := parseAddr(parms[0])
+	if err != nil {
+		fh.logf("%v", err)
+		return "501 Can't parse address."
+	}
+	if !fh.fromClient(addr) {
+		return "501 Data connection to a third party is not allowed."
+	}
+	fh.addr = addr
+	fh.closePassive()
+	fh.dataMode = "PORT"
+	return "200 PORT command oky."
+}
+
+// TYPE
+//    200
+//    500, 501, 504, 421, 530
+func (fh *ftpHandler) handleTYPE(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 TYPE Syntax error."
+	}
+	args := strings.Fields(strings.ToUpper(parms[0]))
+	switch {
+	case len(args) == 1 && args[0] == "A", len(args) == 2 && args[0] == "A" && args[1] == "N":
+		// Offsets of REST are in bytes of the file, which don't match
+		// the converted data.
+		fh.transferType = 'A'
+		fh.restOffset = 0
+		return "200 Switching to ASCII mode."
+	case len(args) == 1 && args[0] == "I", len(args) == 2 && args[0] == "L" && args[1] == "8":
+		fh.transferType = 'I'
+		return "200 Switching to Binary mode."
+	case len(args) == 0:
+		return "501 TYPE Syntax error."
+	}
+	return "504 Command not implemented for that parameter."
+}
+
+// STRU
+//    200
+//    500, 501, 504, 421, 530
+func (fh *ftpHandler) handleSTRU(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 STRU Syntax error."
+	}
+	if parms[0] != "F" {
+		return "504 Command not implemented for that parameter."
+
+	}
+	return "200 STRU command okay."
+}
+
+// MODE
+//    200
+//    500, 501, 504, 421, 530
+func (fh *ftpHandler) handleMODE(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 MODE Syntax error."
+	}
+	switch strings.ToUpper(parms[0]) {
+	case "S":
+		fh.transferMode = 'S'
+		return "200 Mode set to S."
+	case "Z":
+		fh.transferMode = 'Z'
+		return "200 Mode set to Z."
+	}
+	return "504 Command not implemented for that parameter."
+}
+
+// RETR
+//    125, 150
+//       (110)
+//       226, 250
+//       425, 426, 451
+//    450, 550
+//    500, 501, 421, 530
+func (fh *ftpHandler) handleRETR(parms ...string) string {
+	offset := fh.restOffset
+	fh.restOffset = 0
+	if len(parms) != 1 {
+		return "501 RETR Syntax error."
+	}
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	filename := fh.abspath(parms[0])
+	info, err := fh.fs.Stat(filename)
+	if err != nil || info.IsDir() {
+		fh.logf("%v", err)
+		return "550 File not found."
+	}
+	if offset > info.Size() {
+		return "554 Requested action not taken: invalid REST parameter."
+	}
+	file, err := fh.fs.Open(filename)
+	if err != nil {
+		fh.logf("%v\n", err)
+		return "550 File unavailable."
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		fh.logf("%v\n", err)
+		return "550 File unavailable."
+	}
+	fh.sendmsg("150 File status okay; about to open data connection.")
+	conn, err := fh.dataConn()
+	if err != nil {
+		return "425 Can't open data connection"
+	}
+	defer conn.Close()
+	var w io.Writer = conn
+	if fh.transferType == 'A' {
+		w = &crlfWriter{w: conn}
+	}
+	start := time.Now()
+	n, err := io.Copy(w, file)
+	fh.logTransfer(start, filename, n, 'o', err == nil)
+	if err != nil {
+		fh.logf("%v\n", err)
+		return "426 Connection closed, transfer aborted."
+	}
+
+	return "250 Requested file action okay, completed."
+
+}
+
+// STOR
+//    125, 150
+//       (110)
+//       226, 250
+//       425, 426, 451, 551, 552
+//    532, 450, 452, 553
+//    500, 501, 421, 530
+func (fh *ftpHandler) handleSTOR(parms ...string) string {
+	if len(parms) != 1 {
+		fh.restOffset = 0
+		return "501 STOR Syntax error in parameters"
+	}
+	return fh.store(parms[0], false)
+}
+
+// store receives the file from the data connection. It appends to the file
+// if appe is true, otherwise it writes from the offset given by REST.
+func (fh *ftpHandler) store(name string, appe bool) string {
+	offset := fh.restOffset
+	fh.restOffset = 0
+	if !fh.can(permWrite) {
+		return "550 Permission denied."
+	}
+	filename := fh.abspath(name)
+	info, err := fh.fs.Stat(filename)
+	switch {
+	case err == nil && info.IsDir():
+		return "550 File can't be created."
+	case appe && err == nil:
+		offset = info.Size()
+	case appe:
+		offset = 0
+	case offset > 0 && (err != nil || offset > info.Size()):
+		return "554 Requested action not taken: invalid REST parameter."
+	}
+	left := int64(-1) // bytes allowed by the quota, -1 means unlimited
+	if fh.account.Quota > 0 {
+		var truncated int64
+		if err == nil && !appe {
+			truncated = info.Size() - offset
+		}
+		used, err := diskUsage(fh.fs, "/")
+		if err != nil {
+			fh.logf("%v\n", err)
+			return "451 Requested action aborted: local error in processing."
+		}
+		left = fh.account.Quota - used + truncated
+		if left <= 0 {
+			return "552 Requested file action aborted. Exceeded storage allocation."
+		}
+	}
+	var file File
+	if offset > 0 {
+		file, err = fh.fs.CreateAt(filename, offset)
+	} else {
+		file, err = fh.fs.Create(filename)
+	}
+	if err != nil {
+		fh.logf("%v\n", err)
+		return "550 File can't be created."
+	}
+	defer file.Close()
+	fh.sendmsg("150 Ok to send data.")
+	conn, err := fh.dataConn()
+	if err != nil {
+		return "425 Can't open data connection"
+	}
+	defer conn.Close()
+	var w io.Writer = file
+	if left >= 0 {
+		w = &quotaWriter{w: file, left: left}
+	}
+	start := time.Now()
+	var n int64
+	if fh.transferType == 'A' {
+		lf := &lfWriter{w: w}
+		if n, err = io.Copy(lf, conn); err == nil {
+			err = lf.Flush()
+		}
+	} else {
+		n, err = io.Copy(w, conn)
+	}
+	fh.logTransfer(start, filename, n, 'i', err == nil)
+	if err == errQuota {
+		if !appe && offset == 0 {
+			// Don't leave the truncated file which occupies the quota.
+			file.Close()
+			fh.fs.Remove(filename)
+		}
+		return "552 Requested file action aborted. Exceeded storage allocation."
+	}
+	if err != nil {
+		fh.logf("%v\n", err)
+		return "450 File unavailable."
+	}
+	return "226 Closing data connection. Requested file action successful. " + filename
+}
+
+// NOOP
+// 200
+// 500 421
+func (fh *ftpHandler) handleNOOP(parms ...string) string {
+	return "200 Command okay."
+}
+
+// CWD
+//    250
+//    500, 501, 502, 421, 530, 550
+func (fh *ftpHandler) handleCWD(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 CWD Syntax error in parameters"
+	}
+	dirpath := fh.abspath(parms[0])
+	info, err := fh.fs.Stat(dirpath)
+	if err != nil || !info.IsDir() {
+		return "550 Directory not found."
+	}
+	fh.cwd = dirpath
+	return "250 Requested file action okay, completed. Move to " + fh.cwd
+}
+
+// LIST
+//    125, 150
+//       226, 250
+//       425, 426, 451
+//    450
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handleLIST(parms ...string) string {
+	return fh.list(parms, lsLine)
+}
+
+// lsArg returns the path given to LIST, ignoring options of ls such as "-la".
+func lsArg(parms []string) string {
+	name := strings.Join(parms, " ")
+	for strings.HasPrefix(name, "-") {
+		i := strings.Index(name, " ")
+		if i < 0 {
+			return ""
+		}
+		name = strings.TrimLeft(name[i:], " ")
+	}
+	return name
+}
+
+// list sends the listing of the directory or the file to the data connection.
+// Each entry is formatted by format.
+func (fh *ftpHandler) list(parms []string, format func(info os.FileInfo, name string) string) string {
+	name := lsArg(parms)
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	filename := fh.abspath(name)
+	stat, err := fh.fs.Stat(filename)
+	if err != nil {
+		return "550 File not found."
+	}
+	infos := []os.FileInfo{stat}
+	names := []string{filename}
+	if stat.IsDir() {
+		if infos, err = fh.fs.List(filename); err != nil {
+			fh.logf("%v", err)
+			return "550 Can't read directory."
+		}
+		names = names[:0]
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+	}
+	fh.sendmsg("150 Here comes the directory listing.")
+	w, err := fh.dataConn()
+	if err != nil {
+		return "425 Can't open data connection."
+	}
+	defer w.Close()
+	for i, info := range infos {
+		_, err = fmt.Fprintf(w, "%s\r\n", format(info, names[i]))
+		if err != nil {
+			fh.logf("%v", err)
+			return "426 Connection closed; transfer aborted."
+		}
+	}
+	return "226 Closing data connection. Requested file action successful"
+}
+
+// CDUP
+//    200
+//    500, 501, 502, 421, 530, 550
+func (fh *ftpHandler) handleCDUP(parms ...string) string {
+	fh.cwd = fh.abspath("..")
+	return "200 Command okay. Move to " + fh.cwd
+}
+
+// MKD
+//    257
+//    500, 501, 502, 421, 530, 550
+func (fh *ftpHandler) handleMKD(parms ...string) string {
+	if len(parms) != 1 || parms[0] == "" {
+		return "501 MKD Syntax error in parameters"
+	}
+	if !fh.can(permWrite) {
+		return "550 Permission denied."
+	}
+	dirpath := fh.abspath(parms[0])
+	if err := fh.fs.Mkdir(dirpath); err != nil {
+		fh.logf("%v\n", err)
+		return "550 Can't create directory."
+	}
+	return "257 " + quotePath(dirpath) + " created."
+}
+
+// RMD
+//    250
+//    500, 501, 502, 421, 530, 550
+func (fh *ftpHandler) handleRMD(parms ...string) string {
+	if len(parms) != 1 || parms[0] == "" {
+		return "501 RMD Syntax error in parameters"
+	}
+	if !fh.can(permDelete) {
+		return "550 Permission denied."
+	}
+	dirpath := fh.abspath(parms[0])
+	if dirpath == "/" {
+		return "550 Can't remove root directory."
+	}
+	info, err := fh.fs.Stat(dirpath)
+	if err != nil || !info.IsDir() {
+		return "550 Directory not found."
+	}
+	if err := fh.fs.Remove(dirpath); err != nil {
+		fh.logf("%v\n", err)
+		return "550 Can't remove directory."
+	}
+	return "250 Requested file action okay, completed. Removed " + dirpath
+}
+
+// DELE
+//    250
+//    450, 550
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handleDELE(parms ...string) string {
+	if len(parms) != 1 || parms[0] == "" {
+		return "501 DELE Syntax error in parameters"
+	}
+	if !fh.can(permDelete) {
+		return "550 Permission denied."
+	}
+	filename := fh.abspath(parms[0])
+	info, err := fh.fs.Stat(filename)
+	if err != nil || info.IsDir() {
+		return "550 File not found."
+	}
+	if err := fh.fs.Remove(filename); err != nil {
+		fh.logf("%v\n", err)
+		return "450 Requested file action not taken. File unavailable."
+	}
+	return "250 Requested file action okay, completed. Deleted " + filename
+}
+
+// RNFR
+//    450, 550
+//    500, 501, 502, 421, 530
+//    350
+func (fh *ftpHandler) handleRNFR(parms ...string) string {
+	fh.renameFrom = ""
+	if len(parms) != 1 || parms[0] == "" {
+		return "501 RNFR Syntax error in parameters"
+	}
+	if !fh.can(permWrite) {
+		return "550 Permission denied."
+	}
+	from := fh.abspath(parms[0])
+	if from == "/" {
+		return "550 Can't rename root directory."
+	}
+	if _, err := fh.fs.Stat(from); err != nil {
+		return "550 File not found."
+	}
+	fh.renameFrom = from
+	return "350 Requested file action pending further information."
+}
+
+// RNTO
+//    250
+//    532, 553
+//    500, 501, 502, 503, 421, 530
+func (fh *ftpHandler) handleRNTO(parms ...string) string {
+	from := fh.renameFrom
+	fh.renameFrom = ""
+	if from == "" || fh.precmd != "RNFR" {
+		return "503 Bad sequence of commands. Send RNFR first."
+	}
+	if len(parms) != 1 || parms[0] == "" {
+		return "501 RNTO Syntax error in parameters"
+	}
+	to := fh.abspath(parms[0])
+	if to == "/" {
+		return "553 Requested action not taken. File name not allowed."
+	}
+	if err := fh.fs.Rename(from, to); err != nil {
+		fh.logf("%v\n", err)
+		return "553 Requested action not taken. File name not allowed."
+	}
+	return "250 Requested file action okay, completed. Renamed " + from + " to " + to
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsetext(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected []string
+	}{
+		{"NOOP", []string{"NOOP"}},
+		{"noop ", []string{"NOOP"}},
+		{"cwd my docs", []string{"CWD", "my docs"}},
+		{"RETR  two  spaces.txt", []string{"RETR", " two  spaces.txt"}},
+		{"TYPE A N", []string{"TYPE", "A N"}},
+	}
+	fh := &ftpHandler{}
+	for _, test := range tests {
+		if got := fh.parsetext(test.line); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("parsetext(%q) = %q, Expected %q", test.line, got, test.expected)
+		}
+	}
+}
+
+func TestLsArg(t *testing.T) {
+	var tests = []struct {
+		parms    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"-la"}, ""},
+		{[]string{"-a -l my docs"}, "my docs"},
+		{[]string{"docs"}, "docs"},
+	}
+	for _, test := range tests {
+		if got := lsArg(test.parms); got != test.expected {
+			t.Errorf("lsArg(%q) = %q, Expected %q", test.parms, got, test.expected)
+		}
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	got := multiline(211, "Features:", []string{"MDTM", "SIZE"}, "End")
+	expected := "211-Features:\n MDTM\n SIZE\n211 End"
+	if got != expected {
+		t.Errorf("Result = %q, Expected %q", got, expected)
+	}
+}
+
+func TestServerFileCommands(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Users: &UserDB{accounts: map[string]*account{
+		"alice": {Name: "alice", Password: hash, Home: "alice", perm: permRead | permWrite | permDelete},
+		"bob":   {Name: "bob", Password: hash, Home: "alice", perm: permRead},
+	}}}
+	addr := startServer(t, s)
+	c := dial(t, addr, 220)
+	cmd(t, c, 331, "USER alice")
+	cmd(t, c, 230, "PASS secret")
+	if code := upload(t, c, addr, "a.txt", "hello"); code != 226 {
+		t.Fatalf("Result = %d, Expected 226", code)
+	}
+	var tests = []struct {
+		line   string
+		code   int
+		expect string // substring of the reply, if any
+	}{
+		{"MKD", 501, ""},
+		{"MKD docs", 257, `"/docs"`},
+		{"MKD docs", 550, ""},
+		{"XMKD docs/sub", 257, `"/docs/sub"`},
+		{"CWD docs/sub", 250, "/docs/sub"},
+		{"CDUP", 200, "/docs"},
+		{"CDUP", 200, "Move to /"},
+		{"CDUP", 200, "Move to /"}, // stays at the root
+		{"RMD", 501, ""},
+		{"RMD docs/sub", 250, "/docs/sub"},
+		{"RMD docs/sub", 550, ""},
+		{"RMD a.txt", 550, ""},
+		{"RMD /", 550, ""},
+
+		// RNTO must follow RNFR immediately.
+		{"RNTO b.txt", 503, ""},
+		{"RNFR", 501, ""},
+		{"RNFR missing.txt", 550, ""},
+		{"RNTO b.txt", 503, ""},
+		{"RNFR /", 550, ""},
+		{"RNFR a.txt", 350, ""},
+		{"NOOP", 200, ""},
+		{"RNTO b.txt", 503, ""},
+		{"RNFR a.txt", 350, ""},
+		{"RNTO /", 553, ""},
+		{"RNTO b.txt", 503, ""},
+		{"RNFR a.txt", 350, ""},
+		{"RNTO docs/b.txt", 250, "/a.txt to /docs/b.txt"},
+		{"RNTO c.txt", 503, ""},
+
+		{"DELE", 501, ""},
+		{"DELE a.txt", 550, ""},
+		{"DELE docs", 550, ""},
+		{"DELE docs/b.txt", 250, "/docs/b.txt"},
+		{"DELE docs/b.txt", 550, ""},
+		{"RMD docs", 250, ""},
+	}
+	for _, test := range tests {
+		if msg := cmd(t, c, test.code, "%s", test.line); !strings.Contains(msg, test.expect) {
+			t.Errorf("%s = %q, Expected %q", test.line, msg, test.expect)
+		}
+	}
+	cmd(t, c, 221, "QUIT")
+
+	// A read-only user can't change anything.
+	c = dial(t, addr, 220)
+	cmd(t, c, 331, "USER bob")
+	cmd(t, c, 230, "PASS secret")
+	for _, line := range []string{"MKD docs", "RMD docs", "DELE a.txt", "RNFR a.txt"} {
+		if msg := cmd(t, c, 550, "%s", line); !strings.Contains(msg, "Permission denied") {
+			t.Errorf("%s = %q, Expected Permission denied", line, msg)
+		}
+	}
+	cmd(t, c, 503, "RNTO b.txt")
+}
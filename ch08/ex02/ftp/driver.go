@@ -0,0 +1,39 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"io"
+	"os"
+)
+
+// File is a file opened by Driver.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// Driver is a storage backend of FTP server.
+// Every name is a virtual path such as "/docs/a.txt", and "/" is the home
+// directory of the session. Drivers must not allow access outside of it.
+type Driver interface {
+	// Open opens the file for reading.
+	Open(name string) (File, error)
+	// Create creates the file for writing, truncating it if it already exists.
+	Create(name string) (File, error)
+	// CreateAt opens the file for writing at offset, creating it if it
+	// doesn't exist. Data after offset is discarded.
+	CreateAt(name string, offset int64) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	// List returns the entries of the directory sorted by name.
+	List(name string) ([]os.FileInfo, error)
+	Mkdir(name string) error
+	// Remove removes the file or the empty directory.
+	Remove(name string) error
+	Rename(oldname, newname string) error
+}
+
+// DriverFunc returns Driver for home, the home directory of the user
+// relative to the root of the storage.
+type DriverFunc func(home string) (Driver, error)
@@ -0,0 +1,204 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVpath(t *testing.T) {
+	var tests = []struct {
+		cwd, name string
+		expected  string
+	}{
+		{"/", "", "/"},
+		{"/", "docs", "/docs"},
+		{"/docs", "a.txt", "/docs/a.txt"},
+		{"/docs", "..", "/"},
+		{"/docs", "../../etc", "/etc"},
+		{"/docs", "/pub/../etc/passwd", "/etc/passwd"},
+		{"/", "../../../", "/"},
+	}
+	for _, test := range tests {
+		if got := vpath(test.cwd, test.name); got != test.expected {
+			t.Errorf("vpath(%q, %q) = %q, Expected %q", test.cwd, test.name, got, test.expected)
+		}
+	}
+}
+
+func TestLocalDriverReal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs", filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "evil"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs/new.txt", filepath.Join(root, "new")); err != nil {
+		t.Fatal(err)
+	}
+	d := &localDriver{root}
+	var tests = []struct {
+		vp string
+		ok bool
+	}{
+		{"/dangling", false},
+		{"/new", true},
+		{"/", true},
+		{"/docs", true},
+		{"/docs/new.txt", true},
+		{"/inside/new.txt", true},
+		{"/escape", false},
+		{"/escape/root/docs", true},
+		{"/escape/new.txt", false},
+	}
+	for _, test := range tests {
+		_, err := d.real(test.vp)
+		if (err == nil) != test.ok {
+			t.Errorf("real(%q) = %v, Expected ok %v", test.vp, err, test.ok)
+		}
+	}
+
+	// Files are created at the resolved path.
+	if p, err := d.real("/new"); err != nil || p != filepath.Join(root, "docs", "new.txt") {
+		t.Errorf("real(%q) = %q, %v, Expected %q", "/new", p, err, filepath.Join(root, "docs", "new.txt"))
+	}
+	if f, err := d.Create("/dangling"); err == nil {
+		f.Close()
+		t.Errorf("Result = nil, Expected Create through a dangling link to fail")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Errorf("Result = %v, Expected no file outside of the root", err)
+	}
+}
+
+func TestLocalDriverLinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"link", "other"} {
+		if err := os.Symlink("docs/a.txt", filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &localDriver{root}
+
+	// The links are removed and renamed, not the file they point to.
+	if err := d.Remove("/link"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := d.Rename("/other", "/docs/renamed"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	var tests = []struct {
+		name   string
+		exists bool
+		link   bool
+	}{
+		{"link", false, false},
+		{"other", false, false},
+		{"docs/renamed", true, true},
+		{"docs/a.txt", true, false},
+	}
+	for _, test := range tests {
+		info, err := os.Lstat(filepath.Join(root, test.name))
+		if (err == nil) != test.exists {
+			t.Errorf("Lstat(%s) = %v, Expected exists %v", test.name, err, test.exists)
+			continue
+		}
+		if err == nil && (info.Mode()&os.ModeSymlink != 0) != test.link {
+			t.Errorf("Lstat(%s) = %v, Expected link %v", test.name, info.Mode(), test.link)
+		}
+	}
+	if err := d.Rename("/docs/renamed", "/../renamed"); err != nil {
+		t.Errorf("Result = %v, Expected .. to stay in the root", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "renamed")); err != nil {
+		t.Errorf("Result = %v, Expected the link at the root", err)
+	}
+}
+
+func TestDrivers(t *testing.T) {
+	drivers := map[string]DriverFunc{
+		"disk":   DiskDriver(t.TempDir()),
+		"memory": MemoryDriver(),
+	}
+	for name, newDriver := range drivers {
+		d, err := newDriver("/")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		testDriver(t, name, d)
+	}
+}
+
+func testDriver(t *testing.T, name string, d Driver) {
+	if err := d.Mkdir("/docs"); err != nil {
+		t.Fatalf("%s: Mkdir: %v", name, err)
+	}
+	if err := d.Mkdir("/docs"); !os.IsExist(err) {
+		t.Errorf("%s: Mkdir existing directory = %v, Expected exist error", name, err)
+	}
+	f, err := d.Create("/docs/a.txt")
+	if err != nil {
+		t.Fatalf("%s: Create: %v", name, err)
+	}
+	io.WriteString(f, "hello")
+	f.Close()
+
+	info, err := d.Stat("/docs/a.txt")
+	if err != nil || info.Size() != 5 || info.IsDir() {
+		t.Errorf("%s: Stat = %v, %v, Expected 5 bytes file", name, info, err)
+	}
+	if err := d.Rename("/docs/a.txt", "/b.txt"); err != nil {
+		t.Errorf("%s: Rename: %v", name, err)
+	}
+	f, err = d.Open("/b.txt")
+	if err != nil {
+		t.Fatalf("%s: Open: %v", name, err)
+	}
+	f.Seek(1, io.SeekStart)
+	b, _ := io.ReadAll(f)
+	f.Close()
+	if string(b) != "ello" {
+		t.Errorf("%s: Read = %q, Expected %q", name, b, "ello")
+	}
+	f, err = d.CreateAt("/b.txt", 3)
+	if err != nil {
+		t.Fatalf("%s: CreateAt: %v", name, err)
+	}
+	io.WriteString(f, "p!")
+	f.Close()
+	f, _ = d.Open("/b.txt")
+	b, _ = io.ReadAll(f)
+	f.Close()
+	if string(b) != "help!" {
+		t.Errorf("%s: Read after CreateAt = %q, Expected %q", name, b, "help!")
+	}
+	infos, err := d.List("/")
+	if err != nil || len(infos) != 2 || infos[0].Name() != "b.txt" || infos[1].Name() != "docs" {
+		t.Errorf("%s: List = %v, %v, Expected [b.txt docs]", name, infos, err)
+	}
+	if _, err := d.Open("/../../b.txt"); err != nil {
+		t.Errorf("%s: Open outside of root = %v, Expected to be confined to root", name, err)
+	}
+	if err := d.Remove("/docs"); err != nil {
+		t.Errorf("%s: Remove: %v", name, err)
+	}
+	if _, err := d.Stat("/docs"); !os.IsNotExist(err) {
+		t.Errorf("%s: Stat removed directory = %v, Expected not exist", name, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// LoadTLSConfig returns the config for explicit FTPS (RFC 4217) using
+// the certificate and the key files.
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// SelfSignedTLSConfig returns the config using a self-signed certificate
+// for localhost. It is only for local testing.
+func SelfSignedTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"gopl ftp server"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// secureDataConn wraps the data connection in TLS for PROT P.
+func (fh *ftpHandler) secureDataConn(conn net.Conn) (io.ReadWriteCloser, error) {
+	tc := tls.Server(conn, fh.srv.TLSConfig)
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// AUTH
+//    234
+//    334
+//    431, 500, 501, 502, 504, 534
+func (fh *ftpHandler) handleAUTH(parms ...string) string {
+	if fh.srv.TLSConfig == nil {
+		return "502 TLS is not configured."
+	}
+	if len(parms) != 1 {
+		return "501 Usage: AUTH TLS"
+	}
+	switch strings.ToUpper(parms[0]) {
+	case "TLS", "TLS-C", "SSL":
+	default:
+		return "504 AUTH " + parms[0] + " not supported."
+	}
+	if fh.tls {
+		return "503 Already using TLS."
+	}
+	fh.sendmsg("234 AUTH TLS successful.")
+	tc := tls.Server(fh.conn, fh.srv.TLSConfig)
+	if err := tc.Handshake(); err != nil {
+		fh.logf("TLS handshake with %v failed: %v\n", fh.conn.RemoteAddr(), err)
+		fh.quit = true
+		return ""
+	}
+	fh.mu.Lock()
+	fh.conn = tc
+	fh.mu.Unlock()
+	fh.tls = true
+	// A new security exchange resets the login state.
+	fh.account = nil
+	fh.user = ""
+	return ""
+}
+
+// PBSZ
+//    200
+//    503
+//    500, 501, 421, 530
+func (fh *ftpHandler) handlePBSZ(parms ...string) string {
+	if !fh.tls {
+		return "503 Send AUTH TLS first."
+	}
+	if len(parms) != 1 {
+		return "501 Usage: PBSZ 0"
+	}
+	fh.pbsz = true
+	return "200 PBSZ=0"
+}
+
+// PROT
+//    200
+//    504, 536, 503, 534, 431
+//    500, 501, 421, 530
+func (fh *ftpHandler) handlePROT(parms ...string) string {
+	if !fh.pbsz {
+		return "503 Send PBSZ first."
+	}
+	if len(parms) != 1 {
+		return "501 Usage: PROT C|P"
+	}
+	switch strings.ToUpper(parms[0]) {
+	case "C":
+		fh.protP = false
+		return "200 Protection level set to Clear."
+	case "P":
+		fh.protP = true
+		return "200 Protection level set to Private."
+	case "S", "E":
+		return "536 Requested PROT level not supported by mechanism."
+	default:
+		return "504 Unknown PROT level."
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+)
+
+func TestServerFTPS(t *testing.T) {
+	config, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		TLSConfig:  config,
+		RequireTLS: true,
+		Users: &UserDB{accounts: map[string]*account{
+			"alice": {Name: "alice", Password: hash, Home: "alice", perm: permRead | permWrite},
+		}},
+	}
+	addr := startServer(t, s)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	if _, msg, err := c.ReadResponse(220); err != nil {
+		t.Fatalf("greeting: %v %s", err, msg)
+	}
+	cmd(t, c, 530, "USER alice")
+	cmd(t, c, 503, "PBSZ 0")
+	cmd(t, c, 504, "AUTH KERBEROS")
+	cmd(t, c, 234, "AUTH TLS")
+
+	tc := tls.Client(conn, client)
+	if err := tc.Handshake(); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	c = textproto.NewConn(tc)
+	cmd(t, c, 503, "AUTH TLS")
+	cmd(t, c, 331, "USER alice")
+	cmd(t, c, 230, "PASS secret")
+	cmd(t, c, 503, "PROT P")
+	cmd(t, c, 200, "PBSZ 0")
+	cmd(t, c, 536, "PROT S")
+	cmd(t, c, 200, "PROT P")
+
+	// The data connections are protected by TLS too.
+	data := tls.Client(epsv(t, c, addr), client)
+	cmd(t, c, 150, "STOR a.txt")
+	if _, err := io.WriteString(data, "hello"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	data.Close()
+	if _, msg, err := c.ReadResponse(226); err != nil {
+		t.Fatalf("STOR: %v %s", err, msg)
+	}
+	data = tls.Client(epsv(t, c, addr), client)
+	cmd(t, c, 150, "RETR a.txt")
+	got, err := io.ReadAll(data)
+	data.Close()
+	if err != nil || string(got) != "hello" {
+		t.Errorf("Result = %q, %v, Expected hello", got, err)
+	}
+	if _, msg, err := c.ReadResponse(2); err != nil {
+		t.Fatalf("RETR: %v %s", err, msg)
+	}
+
+	// A client without TLS on the data connection can't get the file.
+	plain := epsv(t, c, addr)
+	cmd(t, c, 150, "RETR a.txt")
+	io.WriteString(plain, "not a TLS handshake\r\n")
+	plain.Close()
+	if code, _, _ := c.ReadResponse(0); code/100 != 4 {
+		t.Errorf("Result = %d, Expected a transient error", code)
+	}
+	cmd(t, c, 221, "QUIT")
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FEAT
+//    211
+//    500, 502
+func (fh *ftpHandler) handleFEAT(parms ...string) string {
+	feats := []string{
+		"EPRT",
+		"EPSV",
+		"MDTM",
+		"MLST " + strings.Join(mlstFacts, "*;") + "*;",
+		"MODE Z",
+		"PASV",
+		"REST STREAM",
+		"SIZE",
+		"UTF8",
+	}
+	if fh.srv.TLSConfig != nil {
+		feats = append(feats, "AUTH TLS", "PBSZ", "PROT")
+	}
+	return multiline(211, "Features:", feats, "End")
+}
+
+// SYST
+//    215
+//    500, 501, 502, 421
+func (fh *ftpHandler) handleSYST(parms ...string) string {
+	return "215 UNIX Type: L8"
+}
+
+// HELP
+//    211, 214
+//    500, 501, 502, 421
+func (fh *ftpHandler) handleHELP(parms ...string) string {
+	if len(parms) == 1 {
+		c := strings.ToUpper(parms[0])
+		if _, ok := cmdMap[c]; !ok {
+			return "502 Unknown command " + c + "."
+		}
+		return "214 " + c + " is supported."
+	}
+	var names []string
+	for c := range cmdMap {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+	var lines []string
+	for i := 0; i < len(names); i += 8 {
+		end := i + 8
+		if end > len(names) {
+			end = len(names)
+		}
+		lines = append(lines, strings.Join(names[i:end], " "))
+	}
+	return multiline(214, "The following commands are recognized.", lines, "Help OK.")
+}
+
+// STAT
+//    211, 212, 213
+//    450
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handleSTAT(parms ...string) string {
+	if len(parms) == 0 {
+		return multiline(211, "FTP server status:", fh.status(), "End of status")
+	}
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	name := fh.abspath(lsArg(parms))
+	stat, err := fh.fs.Stat(name)
+	if err != nil {
+		return "450 File not found."
+	}
+	var lines []string
+	if !stat.IsDir() {
+		lines = append(lines, lsLine(stat, name))
+	} else {
+		infos, err := fh.fs.List(name)
+		if err != nil {
+			return "450 Can't read directory."
+		}
+		for _, info := range infos {
+			lines = append(lines, lsLine(info, info.Name()))
+		}
+	}
+	return multiline(213, "Status of "+name+":", lines, "End of status")
+}
+
+// status returns the status of the session for STAT.
+func (fh *ftpHandler) status() []string {
+	lines := []string{"Connected from " + fh.conn.RemoteAddr().String()}
+	if fh.loggedIn() {
+		lines = append(lines, "Logged in as "+fh.account.Name)
+	} else {
+		lines = append(lines, "Not logged in")
+	}
+	switch {
+	case fh.tls && fh.protP:
+		lines = append(lines, "Control connection is TLS, data connections are TLS")
+	case fh.tls:
+		lines = append(lines, "Control connection is TLS, data connections are clear")
+	default:
+		lines = append(lines, "Connections are clear")
+	}
+	typ, mode := "BINARY", "STREAM"
+	if fh.transferType == 'A' {
+		typ = "ASCII"
+	}
+	if fh.transferMode == 'Z' {
+		mode = "DEFLATE"
+	}
+	lines = append(lines, "TYPE: "+typ+", MODE: "+mode)
+	switch fh.dataMode {
+	case "PORT":
+		lines = append(lines, "Data connection: active to "+fh.addr)
+	case "PASV":
+		lines = append(lines, "Data connection: passive")
+	default:
+		lines = append(lines, "Data connection: not specified")
+	}
+	return lines
+}
+
+// OPTS
+//    200
+//    451, 500, 501, 502
+func (fh *ftpHandler) handleOPTS(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 Usage: OPTS command [options]"
+	}
+	opts := strings.Fields(strings.ToUpper(parms[0]))
+	if len(opts) == 0 {
+		return "501 Usage: OPTS command [options]"
+	}
+	switch opts[0] {
+	case "UTF8":
+		if len(opts) == 1 || opts[1] == "ON" {
+			return "200 Always in UTF8 mode."
+		}
+		return "504 UTF8 can't be turned off."
+	case "MODE":
+		return fh.optsModeZ(opts[1:])
+	default:
+		return "501 Option " + opts[0] + " not understood."
+	}
+}
+
+// optsModeZ sets the options of MODE Z such as "OPTS MODE Z LEVEL 9".
+func (fh *ftpHandler) optsModeZ(opts []string) string {
+	if len(opts) == 0 || opts[0] != "Z" {
+		return "501 Only MODE Z has options."
+	}
+	level := fh.zlevel
+	for i := 1; i < len(opts); i += 2 {
+		if i+1 >= len(opts) {
+			return "501 Missing value of " + opts[i] + "."
+		}
+		switch opts[i] {
+		case "LEVEL":
+			n, err := strconv.Atoi(opts[i+1])
+			if err != nil || n < zlib.NoCompression || n > zlib.BestCompression {
+				return "501 LEVEL must be 0 to 9."
+			}
+			level = n
+		default:
+			return "501 Option " + opts[i] + " not understood."
+		}
+	}
+	fh.zlevel = level
+	return fmt.Sprintf("200 MODE Z LEVEL set to %d.", level)
+}
+
+// SITE
+//    200
+//    202
+//    500, 501, 530
+func (fh *ftpHandler) handleSITE(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 Usage: SITE command"
+	}
+	args := strings.Fields(parms[0])
+	if len(args) == 0 {
+		return "501 Usage: SITE command"
+	}
+	switch strings.ToUpper(args[0]) {
+	case "HELP":
+		return multiline(214, "The following SITE commands are recognized.", []string{"HELP"}, "Help OK.")
+	default:
+		return fmt.Sprintf("504 SITE %s not supported.", strings.ToUpper(args[0]))
+	}
+}
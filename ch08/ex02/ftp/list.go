@@ -0,0 +1,138 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// lsMode returns the mode string of "ls -l" such as "drwxr-xr-x".
+func lsMode(m os.FileMode) string {
+	t := "-"
+	switch {
+	case m.IsDir():
+		t = "d"
+	case m&os.ModeSymlink != 0:
+		t = "l"
+	case m&os.ModeNamedPipe != 0:
+		t = "p"
+	case m&os.ModeSocket != 0:
+		t = "s"
+	case m&os.ModeCharDevice != 0:
+		t = "c"
+	case m&os.ModeDevice != 0:
+		t = "b"
+	}
+	return t + m.Perm().String()[1:]
+}
+
+// lsTime returns the time of "ls -l". The year is shown instead of the time
+// if t is older than six months or in the future.
+func lsTime(t time.Time) string {
+	now := time.Now()
+	if t.Before(now.AddDate(0, -6, 0)) || t.After(now.Add(time.Hour)) {
+		return t.Format("Jan _2  2006")
+	}
+	return t.Format("Jan _2 15:04")
+}
+
+// lsLine formats the entry like "ls -l" for LIST.
+func lsLine(info os.FileInfo, name string) string {
+	return fmt.Sprintf("%s 1 ftp ftp %12d %s %s",
+		lsMode(info.Mode()), info.Size(), lsTime(info.ModTime()), name)
+}
+
+// nameLine formats the entry for NLST.
+func nameLine(info os.FileInfo, name string) string {
+	return name
+}
+
+// facts of MLST and MLSD defined in RFC 3659.
+var mlstFacts = []string{"type", "size", "modify", "perm"}
+
+// mlsxPerm returns the "perm" fact allowed for the user.
+func (fh *ftpHandler) mlsxPerm(info os.FileInfo) string {
+	var p string
+	if info.IsDir() {
+		if fh.can(permRead) {
+			p += "el"
+		}
+		if fh.can(permWrite) {
+			p += "cmf"
+		}
+		if fh.can(permDelete) {
+			p += "d"
+		}
+		return p
+	}
+	if fh.can(permRead) {
+		p += "r"
+	}
+	if fh.can(permWrite) {
+		p += "awf"
+	}
+	if fh.can(permDelete) {
+		p += "d"
+	}
+	return p
+}
+
+// mlsxLine formats the entry as facts and the name for MLST and MLSD.
+func (fh *ftpHandler) mlsxLine(info os.FileInfo, name string) string {
+	t := "file"
+	if info.IsDir() {
+		t = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s;perm=%s; %s",
+		t, info.Size(), info.ModTime().UTC().Format("20060102150405"), fh.mlsxPerm(info), name)
+}
+
+// NLST
+//    125, 150
+//       226, 250
+//       425, 426, 451
+//    450
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handleNLST(parms ...string) string {
+	return fh.list(parms, nameLine)
+}
+
+// MLSD
+//    125, 150
+//       226, 250
+//       425, 426, 451
+//    450
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handleMLSD(parms ...string) string {
+	if len(parms) > 1 {
+		return "501 Too many arguments."
+	}
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	name := strings.Join(parms, "")
+	if info, err := fh.fs.Stat(fh.abspath(name)); err != nil || !info.IsDir() {
+		return "501 Not a directory."
+	}
+	return fh.list(parms, fh.mlsxLine)
+}
+
+// MLST
+//    250
+//    500, 501, 502, 421, 530, 550
+func (fh *ftpHandler) handleMLST(parms ...string) string {
+	if len(parms) > 1 {
+		return "501 Too many arguments."
+	}
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	filename := fh.abspath(strings.Join(parms, ""))
+	info, err := fh.fs.Stat(filename)
+	if err != nil {
+		return "550 File not found."
+	}
+	return multiline(250, "Listing "+filename, []string{fh.mlsxLine(info, filename)}, "End")
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLsMode(t *testing.T) {
+	var tests = []struct {
+		mode     os.FileMode
+		expected string
+	}{
+		{0644, "-rw-r--r--"},
+		{os.ModeDir | 0755, "drwxr-xr-x"},
+		{os.ModeSymlink | 0777, "lrwxrwxrwx"},
+		{os.ModeNamedPipe | 0600, "prw-------"},
+	}
+	for _, test := range tests {
+		if got := lsMode(test.mode); got != test.expected {
+			t.Errorf("lsMode(%v) = %q, Expected %q", test.mode, got, test.expected)
+		}
+	}
+}
+
+func TestLsLine(t *testing.T) {
+	old := time.Date(2016, 8, 20, 21, 57, 34, 0, time.UTC)
+	info := &memFileInfo{"rfc.txt", 139979, false, old}
+	expected := "-rw-r--r-- 1 ftp ftp       139979 Aug 20  2016 rfc.txt"
+	if got := lsLine(info, "rfc.txt"); got != expected {
+		t.Errorf("Result = %q, Expected %q", got, expected)
+	}
+}
+
+func TestMlsxLine(t *testing.T) {
+	mod := time.Date(2016, 8, 20, 21, 57, 34, 0, time.UTC)
+	var tests = []struct {
+		perm     perm
+		info     os.FileInfo
+		expected string
+	}{
+		{permRead, &memFileInfo{"a.txt", 5, false, mod},
+			"type=file;size=5;modify=20160820215734;perm=r; a.txt"},
+		{permRead | permWrite | permDelete, &memFileInfo{"a.txt", 5, false, mod},
+			"type=file;size=5;modify=20160820215734;perm=rawfd; a.txt"},
+		{permRead | permWrite, &memFileInfo{"docs", 0, true, mod},
+			"type=dir;size=0;modify=20160820215734;perm=elcmf; docs"},
+	}
+	for _, test := range tests {
+		fh := &ftpHandler{account: &account{perm: test.perm}}
+		if got := fh.mlsxLine(test.info, test.info.Name()); got != test.expected {
+			t.Errorf("Result = %q, Expected %q", got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var errOutsideRoot = errors.New("path is outside of the root directory")
+
+// localDriver stores files on the local disk under root.
+type localDriver struct {
+	root string // home directory on the host
+}
+
+// DiskDriver returns DriverFunc which stores files on the local disk under root.
+// home is resolved like a virtual path, so that ".." never goes above root.
+func DiskDriver(root string) DriverFunc {
+	return func(home string) (Driver, error) {
+		dir := filepath.Join(root, filepath.FromSlash(path.Clean("/"+home)))
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+		return &localDriver{dir}, nil
+	}
+}
+
+// real returns the host path of the virtual path vp with symbolic links
+// resolved. It fails if a symbolic link leads outside of the root.
+func (d *localDriver) real(vp string) (string, error) {
+	root, err := filepath.EvalSymlinks(d.root)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(root, filepath.FromSlash(path.Clean("/"+vp)))
+	resolved, err := evalExisting(p)
+	if err != nil {
+		return "", err
+	}
+	if !within(root, resolved) {
+		return "", &os.PathError{Op: "resolve", Path: vp, Err: errOutsideRoot}
+	}
+	return resolved, nil
+}
+
+// realEntry is like real, but doesn't resolve the last element of vp, so
+// that a symbolic link itself is removed or renamed instead of its target.
+func (d *localDriver) realEntry(vp string) (string, error) {
+	vp = path.Clean("/" + vp)
+	if vp == "/" {
+		return d.real(vp)
+	}
+	dir, err := d.real(path.Dir(vp))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path.Base(vp)), nil
+}
+
+// evalExisting evaluates symbolic links of the longest existing prefix of p,
+// so that files to be created can be checked too. A dangling symbolic link
+// is evaluated to the file it would create.
+func evalExisting(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	dir, file := filepath.Split(p)
+	dir = filepath.Clean(dir)
+	if dir == p {
+		return p, nil
+	}
+	resolved, err = evalExisting(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved = filepath.Join(resolved, file)
+	if info, err := os.Lstat(resolved); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(resolved)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(resolved), link)
+		}
+		return evalExisting(link)
+	}
+	return resolved, nil
+}
+
+// within reports whether p is root or under root.
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (d *localDriver) Open(name string) (File, error) {
+	p, err := d.real(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *localDriver) Create(name string) (File, error) {
+	p, err := d.real(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *localDriver) CreateAt(name string, offset int64) (File, error) {
+	p, err := d.real(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Truncate(offset); err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *localDriver) Stat(name string) (os.FileInfo, error) {
+	p, err := d.real(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (d *localDriver) List(name string) ([]os.FileInfo, error) {
+	p, err := d.real(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (d *localDriver) Mkdir(name string) error {
+	p, err := d.real(name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, 0755)
+}
+
+func (d *localDriver) Remove(name string) error {
+	p, err := d.realEntry(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (d *localDriver) Rename(oldname, newname string) error {
+	op, err := d.realEntry(oldname)
+	if err != nil {
+		return err
+	}
+	np, err := d.realEntry(newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(op, np)
+}
@@ -0,0 +1,339 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memNode is a file or a directory in memFS.
+type memNode struct {
+	name     string
+	dir      bool
+	data     []byte
+	modTime  time.Time
+	children map[string]*memNode
+}
+
+// memFS is a filesystem on memory shared by every session.
+type memFS struct {
+	mu   sync.Mutex
+	root *memNode
+}
+
+func newMemFS() *memFS {
+	return &memFS{root: &memNode{name: "/", dir: true, modTime: time.Now(), children: map[string]*memNode{}}}
+}
+
+// lookup returns the node of the cleaned absolute path p. fs.mu must be held.
+func (fs *memFS) lookup(p string) (*memNode, error) {
+	n := fs.root
+	for _, name := range strings.Split(p, "/") {
+		if name == "" {
+			continue
+		}
+		if !n.dir {
+			return nil, os.ErrNotExist
+		}
+		c, ok := n.children[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		n = c
+	}
+	return n, nil
+}
+
+// parent returns the directory which contains p. fs.mu must be held.
+func (fs *memFS) parent(p string) (*memNode, error) {
+	if p == "/" {
+		return nil, os.ErrPermission
+	}
+	dir, err := fs.lookup(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	if !dir.dir {
+		return nil, os.ErrNotExist
+	}
+	return dir, nil
+}
+
+// mkdirAll creates the directory p and its parents.
+func (fs *memFS) mkdirAll(p string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n := fs.root
+	for _, name := range strings.Split(p, "/") {
+		if name == "" {
+			continue
+		}
+		c, ok := n.children[name]
+		if !ok {
+			c = &memNode{name: name, dir: true, modTime: time.Now(), children: map[string]*memNode{}}
+			n.children[name] = c
+		}
+		if !c.dir {
+			return &os.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+		}
+		n = c
+	}
+	return nil
+}
+
+// memDriver is Driver backed by memFS.
+type memDriver struct {
+	fs   *memFS
+	root string // home directory in fs
+}
+
+// MemoryDriver returns DriverFunc which keeps files on memory until the
+// process exits. Home directories are created on demand. It is useful for
+// tests and ephemeral environments because nothing is written to disk.
+func MemoryDriver() DriverFunc {
+	fs := newMemFS()
+	return func(home string) (Driver, error) {
+		root := path.Clean("/" + home)
+		if err := fs.mkdirAll(root); err != nil {
+			return nil, err
+		}
+		return &memDriver{fs, root}, nil
+	}
+}
+
+// full returns the path in fs of the virtual path name.
+func (d *memDriver) full(name string) string {
+	return path.Join(d.root, path.Clean("/"+name))
+}
+
+func (d *memDriver) Open(name string) (File, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	n, err := d.fs.lookup(d.full(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	if n.dir {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	return &memFile{fs: d.fs, node: n}, nil
+}
+
+func (d *memDriver) Create(name string) (File, error) {
+	return d.CreateAt(name, 0)
+}
+
+func (d *memDriver) CreateAt(name string, offset int64) (File, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	p := d.full(name)
+	dir, err := d.fs.parent(p)
+	if err != nil {
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	n, ok := dir.children[path.Base(p)]
+	if ok && n.dir {
+		return nil, &os.PathError{Op: "create", Path: name, Err: errors.New("is a directory")}
+	}
+	if !ok {
+		n = &memNode{name: path.Base(p)}
+		dir.children[n.name] = n
+	}
+	if offset < int64(len(n.data)) {
+		n.data = n.data[:offset]
+	}
+	n.modTime = time.Now()
+	return &memFile{fs: d.fs, node: n, off: offset, writable: true}, nil
+}
+
+func (d *memDriver) Stat(name string) (os.FileInfo, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	n, err := d.fs.lookup(d.full(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return n.info(), nil
+}
+
+func (d *memDriver) List(name string) ([]os.FileInfo, error) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	n, err := d.fs.lookup(d.full(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !n.dir {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	var infos []os.FileInfo
+	for _, c := range n.children {
+		infos = append(infos, c.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (d *memDriver) Mkdir(name string) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	p := d.full(name)
+	dir, err := d.fs.parent(p)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	base := path.Base(p)
+	if _, ok := dir.children[base]; ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	dir.children[base] = &memNode{name: base, dir: true, modTime: time.Now(), children: map[string]*memNode{}}
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (d *memDriver) Remove(name string) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	p := d.full(name)
+	if p == d.root {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+	dir, err := d.fs.parent(p)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	n, ok := dir.children[path.Base(p)]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if n.dir && len(n.children) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	delete(dir.children, n.name)
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (d *memDriver) Rename(oldname, newname string) error {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	op, np := d.full(oldname), d.full(newname)
+	if op == d.root || np == d.root {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrPermission}
+	}
+	if strings.HasPrefix(np, op+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errors.New("invalid argument")}
+	}
+	odir, err := d.fs.parent(op)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	n, ok := odir.children[path.Base(op)]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	ndir, err := d.fs.parent(np)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if old, ok := ndir.children[path.Base(np)]; ok && old.dir {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	delete(odir.children, n.name)
+	n.name = path.Base(np)
+	ndir.children[n.name] = n
+	odir.modTime, ndir.modTime = time.Now(), time.Now()
+	return nil
+}
+
+// memFile is File of memDriver.
+type memFile struct {
+	fs       *memFS
+	node     *memNode
+	off      int64
+	writable bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, &os.PathError{Op: "write", Path: f.node.name, Err: os.ErrPermission}
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	end := f.off + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	copy(f.node.data[f.off:], p)
+	f.off = end
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memFileInfo is os.FileInfo of memNode.
+type memFileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+// info returns the snapshot of n. fs.mu must be held.
+func (n *memNode) info() os.FileInfo {
+	return &memFileInfo{n.name, int64(len(n.data)), n.dir, n.modTime}
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.dir }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"compress/zlib"
+	"io"
+)
+
+// crlfWriter converts "\n" to "\r\n" for RETR in TYPE A.
+type crlfWriter struct {
+	w  io.Writer
+	cr bool // the last byte was '\r'
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+len(p)/16)
+	for _, b := range p {
+		if b == '\n' && !c.cr {
+			buf = append(buf, '\r')
+		}
+		buf = append(buf, b)
+		c.cr = b == '\r'
+	}
+	if _, err := c.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lfWriter converts "\r\n" to "\n" for STOR and APPE in TYPE A.
+// Flush must be called after the last Write.
+type lfWriter struct {
+	w  io.Writer
+	cr bool // '\r' is held until the next byte
+}
+
+func (l *lfWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+1)
+	for _, b := range p {
+		if l.cr && b != '\n' {
+			buf = append(buf, '\r')
+		}
+		l.cr = b == '\r'
+		if !l.cr {
+			buf = append(buf, b)
+		}
+	}
+	if _, err := l.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes '\r' held at the end of the data.
+func (l *lfWriter) Flush() error {
+	if !l.cr {
+		return nil
+	}
+	l.cr = false
+	_, err := l.w.Write([]byte{'\r'})
+	return err
+}
+
+// deflateConn is the data connection in MODE Z, which transfers data
+// compressed in zlib format.
+type deflateConn struct {
+	conn  io.ReadWriteCloser
+	level int
+	r     io.ReadCloser
+	w     *zlib.Writer
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		r, err := zlib.NewReader(c.conn)
+		if err != nil {
+			return 0, err
+		}
+		c.r = r
+	}
+	return c.r.Read(p)
+}
+
+func (c *deflateConn) Write(p []byte) (int, error) {
+	if c.w == nil {
+		w, err := zlib.NewWriterLevel(c.conn, c.level)
+		if err != nil {
+			return 0, err
+		}
+		c.w = w
+	}
+	return c.w.Write(p)
+}
+
+// Close finishes the compressed stream and closes the connection. An empty
+// stream is sent if nothing has been read or written, e.g. for an empty file.
+func (c *deflateConn) Close() error {
+	var err error
+	if c.r == nil && c.w == nil {
+		_, err = c.Write(nil)
+	}
+	if c.w != nil {
+		if cerr := c.w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if c.r != nil {
+		c.r.Close()
+	}
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+func TestCrlfWriter(t *testing.T) {
+	var tests = []struct {
+		chunks []string
+		expect string
+	}{
+		{[]string{"a\nb\n"}, "a\r\nb\r\n"},
+		{[]string{"a\r\nb"}, "a\r\nb"},
+		{[]string{"a\r", "\nb\n"}, "a\r\nb\r\n"},
+		{[]string{"\n\n"}, "\r\n\r\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		w := &crlfWriter{w: &b}
+		for _, c := range test.chunks {
+			w.Write([]byte(c))
+		}
+		if b.String() != test.expect {
+			t.Errorf("Result = %q, Expected %q", b.String(), test.expect)
+		}
+	}
+}
+
+func TestLfWriter(t *testing.T) {
+	var tests = []struct {
+		chunks []string
+		expect string
+	}{
+		{[]string{"a\r\nb\r\n"}, "a\nb\n"},
+		{[]string{"a\r", "\nb"}, "a\nb"},
+		{[]string{"a\rb\r\r\n"}, "a\rb\r\n"},
+		{[]string{"a\r"}, "a\r"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		w := &lfWriter{w: &b}
+		for _, c := range test.chunks {
+			w.Write([]byte(c))
+		}
+		w.Flush()
+		if b.String() != test.expect {
+			t.Errorf("Result = %q, Expected %q", b.String(), test.expect)
+		}
+	}
+}
+
+// nopConn is io.ReadWriteCloser over a buffer.
+type nopConn struct{ bytes.Buffer }
+
+func (c *nopConn) Close() error { return nil }
+
+func TestDeflateConn(t *testing.T) {
+	var conn nopConn
+	c := &deflateConn{conn: &conn, level: zlib.BestCompression}
+	io.WriteString(c, "hello, hello, hello")
+	c.Close()
+	r, err := zlib.NewReader(&conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "hello, hello, hello" {
+		t.Errorf("Result = %q, Expected %q", b, "hello, hello, hello")
+	}
+
+	// Nothing transferred is an empty stream.
+	conn.Reset()
+	(&deflateConn{conn: &conn, level: zlib.DefaultCompression}).Close()
+	r, err = zlib.NewReader(&conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(r); len(b) != 0 || err != nil {
+		t.Errorf("Result = %q, %v, Expected empty", b, err)
+	}
+}
+
+func TestServerTypeAndMode(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, &Server{Users: &UserDB{accounts: map[string]*account{
+		"alice": {Name: "alice", Password: hash, perm: permRead | permWrite},
+	}}})
+	c := dial(t, addr, 220)
+	cmd(t, c, 331, "USER alice")
+	cmd(t, c, 230, "PASS secret")
+	cmd(t, c, 504, "TYPE E")
+	cmd(t, c, 504, "MODE B")
+	cmd(t, c, 501, "OPTS MODE Z LEVEL 10")
+	cmd(t, c, 200, "OPTS MODE Z LEVEL 9")
+
+	// TYPE I is the default.
+	if code := upload(t, c, addr, "bin", "a\r\n"); code != 226 {
+		t.Fatalf("Result = %d, Expected 226", code)
+	}
+	if msg := cmd(t, c, 213, "SIZE bin"); msg != "3" {
+		t.Errorf("Result = %q, Expected 3 bytes stored", msg)
+	}
+	cmd(t, c, 350, "REST 1")
+
+	// TYPE A stores "\r\n" as "\n". Byte offsets are refused.
+	cmd(t, c, 200, "TYPE A")
+	cmd(t, c, 550, "SIZE bin")
+	cmd(t, c, 504, "REST 1")
+	cmd(t, c, 350, "REST 0")
+	if code := upload(t, c, addr, "a.txt", "a\r\nb\r\n"); code != 226 {
+		t.Fatalf("Result = %d, Expected 226", code)
+	}
+	cmd(t, c, 200, "TYPE I")
+	if msg := cmd(t, c, 213, "SIZE a.txt"); msg != "4" {
+		t.Errorf("Result = %q, Expected 4 bytes stored", msg)
+	}
+
+	// MODE Z in TYPE A sends "\r\n" compressed.
+	cmd(t, c, 200, "TYPE A N")
+	cmd(t, c, 200, "MODE Z")
+	conn := epsv(t, c, addr)
+	cmd(t, c, 150, "RETR a.txt")
+	r, err := zlib.NewReader(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	conn.Close()
+	if string(b) != "a\r\nb\r\n" || err != nil {
+		t.Errorf("Result = %q, %v, Expected %q", b, err, "a\r\nb\r\n")
+	}
+	if _, _, err := c.ReadResponse(2); err != nil {
+		t.Error(err)
+	}
+	cmd(t, c, 200, "MODE S")
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var errUnsupportedProtocol = errors.New("unsupported network protocol")
+
+// ParsePortRange parses the port range of passive mode such as "50000-50100".
+func ParsePortRange(s string) (min, max int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	if _, err = fmt.Sscanf(s, "%d-%d", &min, &max); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %v", s, err)
+	}
+	if min <= 0 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return min, max, nil
+}
+
+// parseEPRT parses the argument of EPRT, e.g. "|2|::1|5282|", into "host:port".
+func parseEPRT(arg string) (string, error) {
+	if len(arg) < 1 {
+		return "", fmt.Errorf("empty EPRT argument")
+	}
+	fields := strings.Split(arg, arg[:1])
+	if len(fields) != 5 || fields[0] != "" || fields[4] != "" {
+		return "", fmt.Errorf("invalid EPRT argument %q", arg)
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return "", fmt.Errorf("invalid EPRT address %q", fields[2])
+	}
+	switch fields[1] {
+	case "1":
+		if ip.To4() == nil {
+			return "", fmt.Errorf("%q is not an IPv4 address", fields[2])
+		}
+	case "2":
+		if ip.To4() != nil {
+			return "", fmt.Errorf("%q is not an IPv6 address", fields[2])
+		}
+	default:
+		return "", errUnsupportedProtocol
+	}
+	port, err := strconv.Atoi(fields[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid EPRT port %q", fields[3])
+	}
+	return net.JoinHostPort(ip.String(), fields[3]), nil
+}
+
+// listenPassive opens a listener for the data connection on the interface
+// which accepted the control connection.
+func (fh *ftpHandler) listenPassive() error {
+	fh.closePassive()
+	host, _, err := net.SplitHostPort(fh.conn.LocalAddr().String())
+	if err != nil {
+		return err
+	}
+	if fh.srv.PassiveMinPort == 0 {
+		fh.passiveListener, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+		return err
+	}
+	n := fh.srv.PassiveMaxPort - fh.srv.PassiveMinPort + 1
+	start := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		port := fh.srv.PassiveMinPort + (start+i)%n
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			fh.passiveListener = l
+			return nil
+		}
+	}
+	return fmt.Errorf("no free port in %d-%d", fh.srv.PassiveMinPort, fh.srv.PassiveMaxPort)
+}
+
+// closePassive closes the passive listener if exists.
+func (fh *ftpHandler) closePassive() {
+	if fh.passiveListener == nil {
+		return
+	}
+	if err := fh.passiveListener.Close(); err != nil {
+		fh.logf("%v\n", err)
+	}
+	fh.passiveListener = nil
+}
+
+// fromClient reports whether addr, "host:port", is of the host of the
+// control connection. Data connections with other hosts are refused, so
+// that nobody else can steal the data, and the server can't be used for
+// the bounce attack of RFC 2577.
+func (fh *ftpHandler) fromClient(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && net.ParseIP(host).Equal(net.ParseIP(fh.ip))
+}
+
+// acceptPassive accepts the data connection from the client. Connections
+// from other addresses are closed.
+func (fh *ftpHandler) acceptPassive() (net.Conn, error) {
+	for {
+		conn, err := fh.passiveListener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if fh.fromClient(conn.RemoteAddr().String()) {
+			return conn, nil
+		}
+		fh.logf("refused data connection from %v\n", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+// passivePort returns port number of the passive listener.
+func (fh *ftpHandler) passivePort() int {
+	return fh.passiveListener.Addr().(*net.TCPAddr).Port
+}
+
+// passiveIP returns IPv4 address advertised by PASV.
+func (fh *ftpHandler) passiveIP() (net.IP, error) {
+	host := fh.srv.PublicAddr
+	if host == "" {
+		host, _, _ = net.SplitHostPort(fh.conn.LocalAddr().String())
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address", host)
+}
+
+// PASV
+//    227
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handlePASV(parms ...string) string {
+	if fh.epsvAll {
+		return "501 PASV not allowed after EPSV ALL."
+	}
+	ip, err := fh.passiveIP()
+	if err != nil {
+		fh.logf("%v\n", err)
+		return "425 Can't open passive connection. Use EPSV."
+	}
+	if err := fh.listenPassive(); err != nil {
+		fh.logf("%v\n", err)
+		return "425 Can't open passive connection."
+	}
+	fh.dataMode = "PASV"
+	p := fh.passivePort()
+	return fmt.Sprintf("227 Entering Passive Mode (%d,%d,%d,%d,%d,%d).",
+		ip[0], ip[1], ip[2], ip[3], p/256, p%256)
+}
+
+// EPSV
+//    229
+//    500, 501, 502, 421, 522, 530
+func (fh *ftpHandler) handleEPSV(parms ...string) string {
+	if len(parms) > 1 {
+		return "501 Usage: EPSV [1|2|ALL]"
+	}
+	if len(parms) == 1 {
+		switch strings.ToUpper(parms[0]) {
+		case "", "1", "2":
+		case "ALL":
+			fh.epsvAll = true
+			return "200 EPSV ALL command successful."
+		default:
+			return "522 Network protocol not supported, use (1,2)"
+		}
+	}
+	if err := fh.listenPassive(); err != nil {
+		fh.logf("%v\n", err)
+		return "425 Can't open passive connection."
+	}
+	fh.dataMode = "PASV"
+	return fmt.Sprintf("229 Entering Extended Passive Mode (|||%d|)", fh.passivePort())
+}
+
+// EPRT
+//    200
+//    500, 501, 421, 522, 530
+func (fh *ftpHandler) handleEPRT(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 Usage: EPRT |proto|addr|port|"
+	}
+	if fh.epsvAll {
+		return "501 EPRT not allowed after EPSV ALL."
+	}
+	addr, err := parseEPRT(parms[0])
+	if err == errUnsupportedProtocol {
+		return "522 Network protocol not supported, use (1,2)"
+	}
+	if err != nil {
+		fh.logf("%v\n", err)
+		return "501 Can't parse address."
+	}
+	if !fh.fromClient(addr) {
+		return "501 Data connection to a third party is not allowed."
+	}
+	fh.addr = addr
+	fh.closePassive()
+	fh.dataMode = "PORT"
+	return "200 EPRT command successful."
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParsePortRange(t *testing.T) {
+	var tests = []struct {
+		s        string
+		min, max int
+		err      bool
+	}{
+		{"", 0, 0, false},
+		{"50000-50100", 50000, 50100, false},
+		{"50000-50000", 50000, 50000, false},
+		{"50100-50000", 0, 0, true},
+		{"0-100", 0, 0, true},
+		{"60000-70000", 0, 0, true},
+		{"-1-100", 0, 0, true},
+		{"50000", 0, 0, true},
+		{"a-b", 0, 0, true},
+	}
+	for _, test := range tests {
+		min, max, err := ParsePortRange(test.s)
+		if min != test.min || max != test.max || (err != nil) != test.err {
+			t.Errorf("ParsePortRange(%q) = %d, %d, %v, Expected %d, %d, error %v",
+				test.s, min, max, err, test.min, test.max, test.err)
+		}
+	}
+}
+
+func TestParseEPRT(t *testing.T) {
+	var tests = []struct {
+		arg    string
+		expect string
+		err    error // errUnsupportedProtocol, or nil for any error
+	}{
+		{"|1|132.235.1.2|6275|", "132.235.1.2:6275", nil},
+		{"|2|::1|5282|", "[::1]:5282", nil},
+		{"!1!10.0.0.1!21!", "10.0.0.1:21", nil},
+		{"", "", nil},
+		{"|1|10.0.0.1|21", "", nil},
+		{"|1|10.0.0.1|21|x", "", nil},
+		{"|1|10.0.0.1!21|", "", nil},
+		{"1|10.0.0.1|21|", "", nil},
+		{"|1|::1|21|", "", nil},
+		{"|2|10.0.0.1|21|", "", nil},
+		{"|1|example.com|21|", "", nil},
+		{"|3|10.0.0.1|21|", "", errUnsupportedProtocol},
+		{"||10.0.0.1|21|", "", errUnsupportedProtocol},
+		{"|1|10.0.0.1|0|", "", nil},
+		{"|1|10.0.0.1|65536|", "", nil},
+		{"|1|10.0.0.1|ftp|", "", nil},
+	}
+	for _, test := range tests {
+		got, err := parseEPRT(test.arg)
+		switch {
+		case test.expect != "" && (err != nil || got != test.expect):
+			t.Errorf("parseEPRT(%q) = %q, %v, Expected %q", test.arg, got, err, test.expect)
+		case test.expect == "" && err == nil:
+			t.Errorf("parseEPRT(%q) = %q, Expected an error", test.arg, got)
+		case test.err != nil && err != test.err:
+			t.Errorf("parseEPRT(%q) = %v, Expected %v", test.arg, err, test.err)
+		}
+	}
+}
+
+func TestServerActiveThirdParty(t *testing.T) {
+	addr := startServer(t, &Server{})
+	c := dial(t, addr, 220)
+	cmd(t, c, 331, "USER anonymous")
+	cmd(t, c, 230, "PASS guest@example.com")
+	var tests = []struct {
+		line string
+		code int
+	}{
+		{"EPRT |1|10.0.0.1|21|", 501},
+		{"EPRT |2|::2|21|", 501},
+		{"PORT 10,0,0,1,0,21", 501},
+		{"PORT 127,0,0,2,0,21", 501},
+		{"EPRT |1|127.0.0.1|2121|", 200},
+		{"PORT 127,0,0,1,8,73", 200},
+	}
+	for _, test := range tests {
+		cmd(t, c, test.code, "%s", test.line)
+	}
+}
+
+func TestAcceptPassive(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh := &ftpHandler{
+		srv:             &Server{Logger: log.New(io.Discard, "", 0)},
+		ip:              "127.0.0.1",
+		passiveListener: ln,
+	}
+	defer fh.closePassive()
+
+	// Another host connects first.
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}}
+	other, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Skipf("can't dial from 127.0.0.2: %v", err)
+	}
+	defer other.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := fh.acceptPassive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Errorf("Result = %v, Expected %v", conn.RemoteAddr(), client.LocalAddr())
+	}
+	other.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := other.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Result = %v, Expected the connection of the other host to be closed", err)
+	}
+}
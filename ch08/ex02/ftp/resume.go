@@ -0,0 +1,81 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// REST
+//    500, 501, 502, 421, 530
+//    350
+func (fh *ftpHandler) handleREST(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 REST Syntax error in parameters"
+	}
+	offset, err := strconv.ParseInt(parms[0], 10, 64)
+	if err != nil || offset < 0 {
+		return "501 REST requires a non-negative byte offset."
+	}
+	if offset > 0 && fh.transferType == 'A' {
+		return "504 REST is not supported in ASCII mode. Use TYPE I."
+	}
+	fh.restOffset = offset
+	return fmt.Sprintf("350 Restarting at %d. Send STORE or RETRIEVE to initiate transfer.", offset)
+}
+
+// APPE
+//    125, 150
+//       (110)
+//       226, 250
+//       425, 426, 451, 551, 552
+//    532, 450, 550, 452, 553
+//    500, 501, 502, 421, 530
+func (fh *ftpHandler) handleAPPE(parms ...string) string {
+	if len(parms) != 1 {
+		fh.restOffset = 0
+		return "501 APPE Syntax error in parameters"
+	}
+	return fh.store(parms[0], true)
+}
+
+// SIZE
+//    213
+//    550
+//    500, 501, 502, 504
+func (fh *ftpHandler) handleSIZE(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 SIZE Syntax error in parameters"
+	}
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	// The size after converting line endings is unknown without reading
+	// the whole file.
+	if fh.transferType == 'A' {
+		return "550 SIZE is not allowed in ASCII mode. Use TYPE I."
+	}
+	info, err := fh.fs.Stat(fh.abspath(parms[0]))
+	if err != nil || info.IsDir() {
+		return "550 File not found."
+	}
+	return fmt.Sprintf("213 %d", info.Size())
+}
+
+// MDTM
+//    213
+//    550
+//    500, 501, 502
+func (fh *ftpHandler) handleMDTM(parms ...string) string {
+	if len(parms) != 1 {
+		return "501 MDTM Syntax error in parameters"
+	}
+	if !fh.can(permRead) {
+		return "550 Permission denied."
+	}
+	info, err := fh.fs.Stat(fh.abspath(parms[0]))
+	if err != nil || info.IsDir() {
+		return "550 File not found."
+	}
+	return "213 " + info.ModTime().UTC().Format("20060102150405")
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+
+// Package ftp provides an FTP server which can be embedded in other programs.
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown.
+var ErrServerClosed = errors.New("ftp: Server closed")
+
+// default timeouts.
+const (
+	DefaultIdleTimeout = 5 * time.Minute
+	DefaultDataTimeout = 30 * time.Second
+)
+
+// Server is an FTP server. The zero value serves the current directory to
+// anonymous read-only users on ":21".
+type Server struct {
+	Addr   string      // TCP address to listen on, ":21" if empty
+	Root   string      // root directory of DiskDriver, "." if empty
+	Driver DriverFunc  // storage of sessions, DiskDriver(Root) if nil
+	Logger *log.Logger // log.Default() if nil
+	Users  *UserDB     // only anonymous read-only login if nil
+
+	PassiveMinPort int    // lowest port for passive listeners, 0 means any port
+	PassiveMaxPort int    // highest port for passive listeners
+	PublicAddr     string // address advertised in PASV replies, e.g. the NAT address
+
+	TLSConfig  *tls.Config // AUTH TLS is not supported if nil
+	RequireTLS bool        // refuse login without AUTH TLS
+
+	IdleTimeout time.Duration // DefaultIdleTimeout if zero
+	DataTimeout time.Duration // DefaultDataTimeout if zero
+
+	MaxSessions      int // concurrent sessions, 0 means unlimited
+	MaxSessionsPerIP int // concurrent sessions from the same IP address, 0 means unlimited
+
+	TransferLog io.Writer // RETR, STOR and APPE are logged in the xferlog format if not nil
+
+	// Rate limits of data connections in bytes per second, 0 means unlimited.
+	UploadRate        int64 // each session
+	DownloadRate      int64 // each session
+	TotalUploadRate   int64 // all sessions
+	TotalDownloadRate int64 // all sessions
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]bool
+	sessions   map[*ftpHandler]bool
+	perIP      map[string]int
+	inShutdown bool
+	done       chan struct{} // closed when the last session ends in shutdown
+	upLimit    *rateLimiter
+	downLimit  *rateLimiter
+	limitOnce  sync.Once
+	xferMu     sync.Mutex // serializes writes to TransferLog
+}
+
+// ListenAndServe listens on s.Addr and serves FTP sessions.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":21"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln and serves each of them in a new goroutine.
+// It always returns a non-nil error and closes ln.
+func (s *Server) Serve(ln net.Listener) error {
+	defer ln.Close()
+	if !s.trackListener(ln, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(ln, false)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			s.logf("%v", err) // e.g., connection aborted
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		s.logf("Connect from %v\n", conn.RemoteAddr())
+		fh := newFtpHandler(s, conn)
+		if rsp := s.addSession(fh); rsp != "" {
+			fh.sendmsg(rsp)
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.removeSession(fh)
+			fh.execute()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and closes idle sessions with 421.
+// Sessions in the middle of a command, e.g. a transfer, are closed after it
+// completes. If ctx expires first, the control and data connections of the
+// remaining sessions are closed forcibly and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	if s.done == nil {
+		s.done = make(chan struct{})
+		if len(s.sessions) == 0 {
+			close(s.done)
+		}
+	}
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for fh := range s.sessions {
+		fh.interrupt()
+	}
+	done := s.done
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for fh := range s.sessions {
+			fh.closeConn()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// trackListener registers or unregisters ln. It fails after Shutdown.
+func (s *Server) trackListener(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, ln)
+		return true
+	}
+	if s.inShutdown {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = map[net.Listener]bool{}
+	}
+	s.listeners[ln] = true
+	return true
+}
+
+// addSession registers fh. It returns the 421 reply if fh is over the limits.
+func (s *Server) addSession(fh *ftpHandler) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return "421 Service not available, closing control connection."
+	}
+	if s.MaxSessions > 0 && len(s.sessions) >= s.MaxSessions {
+		return "421 Too many users, try again later."
+	}
+	ip := fh.remoteIP()
+	if s.MaxSessionsPerIP > 0 && s.perIP[ip] >= s.MaxSessionsPerIP {
+		return "421 Too many connections from your address."
+	}
+	if s.sessions == nil {
+		s.sessions = map[*ftpHandler]bool{}
+		s.perIP = map[string]int{}
+	}
+	s.sessions[fh] = true
+	s.perIP[ip]++
+	return ""
+}
+
+func (s *Server) removeSession(fh *ftpHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, fh)
+	ip := fh.remoteIP()
+	if s.perIP[ip]--; s.perIP[ip] <= 0 {
+		delete(s.perIP, ip)
+	}
+	if s.inShutdown && len(s.sessions) == 0 {
+		close(s.done)
+	}
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	s.output(3, format, v...)
+}
+
+// output writes the log. calldepth is passed to log.Logger.Output.
+func (s *Server) output(calldepth int, format string, v ...interface{}) {
+	logger := log.Default()
+	if s != nil && s.Logger != nil {
+		logger = s.Logger
+	}
+	logger.Output(calldepth, fmt.Sprintf(format, v...))
+}
+
+func (s *Server) driver() DriverFunc {
+	if s.Driver != nil {
+		return s.Driver
+	}
+	root := s.Root
+	if root == "" {
+		root = "."
+	}
+	return DiskDriver(root)
+}
+
+func (s *Server) users() *UserDB {
+	if s.Users != nil {
+		return s.Users
+	}
+	return defaultUsers
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+func (s *Server) dataTimeout() time.Duration {
+	if s.DataTimeout > 0 {
+		return s.DataTimeout
+	}
+	return DefaultDataTimeout
+}
+
+// limiters returns the global rate limiters for uploads and downloads.
+func (s *Server) limiters() (up, down *rateLimiter) {
+	s.limitOnce.Do(func() {
+		s.upLimit = newRateLimiter(s.TotalUploadRate)
+		s.downLimit = newRateLimiter(s.TotalDownloadRate)
+	})
+	return s.upLimit, s.downLimit
+}
+
+// timeoutConn is the data connection which times out if no data is
+// transferred for the timeout.
+type timeoutConn struct {
+	net.Conn
+	timeout  time.Duration
+	timedOut *bool
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	c.SetDeadline(time.Now().Add(c.timeout))
+	n, err := c.Conn.Read(p)
+	c.check(err)
+	return n, err
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	c.SetDeadline(time.Now().Add(c.timeout))
+	n, err := c.Conn.Write(p)
+	c.check(err)
+	return n, err
+}
+
+func (c *timeoutConn) check(err error) {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		*c.timedOut = true
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startServer serves s on a loopback address and returns the address.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	if s.Driver == nil {
+		s.Driver = MemoryDriver()
+	}
+	if s.Logger == nil {
+		s.Logger = log.New(io.Discard, "", 0)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return ln.Addr().String()
+}
+
+// dial connects to addr and reads the greeting with the expected code.
+func dial(t *testing.T, addr string, code int) *textproto.Conn {
+	t.Helper()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, msg, err := c.ReadResponse(code); err != nil {
+		t.Fatalf("greeting: %v %s", err, msg)
+	}
+	return c
+}
+
+// cmd sends the command and checks the code of the reply.
+func cmd(t *testing.T, c *textproto.Conn, code int, format string, args ...interface{}) string {
+	t.Helper()
+	if _, err := c.Cmd(format, args...); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := c.ReadResponse(code)
+	if err != nil {
+		t.Fatalf("%s: %v", format, err)
+	}
+	return msg
+}
+
+func TestServerLogin(t *testing.T) {
+	addr := startServer(t, &Server{})
+	c := dial(t, addr, 220)
+	cmd(t, c, 530, "PWD")
+	cmd(t, c, 331, "USER anonymous")
+	cmd(t, c, 230, "PASS guest@example.com")
+	cmd(t, c, 257, "PWD")
+	cmd(t, c, 550, "MKD docs")
+	cmd(t, c, 221, "QUIT")
+}
+
+func TestServerSessionLimits(t *testing.T) {
+	addr := startServer(t, &Server{MaxSessions: 2, MaxSessionsPerIP: 1})
+	dial(t, addr, 220)
+	dial(t, addr, 421)
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	addr := startServer(t, &Server{IdleTimeout: 100 * time.Millisecond})
+	c := dial(t, addr, 220)
+	if _, _, err := c.ReadResponse(421); err != nil {
+		t.Errorf("Result = %v, Expected 421 after idle timeout", err)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := &Server{}
+	addr := startServer(t, s)
+	c := dial(t, addr, 220)
+	cmd(t, c, 200, "NOOP")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, _, err := c.ReadResponse(421); err != nil {
+		t.Errorf("Result = %v, Expected 421 on shutdown", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Errorf("Dial after Shutdown succeeded, Expected to be refused")
+	}
+}
+
+func TestServerSessionPerIPAfterPORT(t *testing.T) {
+	addr := startServer(t, &Server{MaxSessionsPerIP: 1})
+	c := dial(t, addr, 220)
+	cmd(t, c, 331, "USER anonymous")
+	cmd(t, c, 230, "PASS guest@example.com")
+	cmd(t, c, 200, "PORT 127,0,0,1,4,1")
+	cmd(t, c, 221, "QUIT")
+	// The session of the address of the control connection is released.
+	for i := 0; ; i++ {
+		c, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _, _ := c.ReadResponse(0)
+		c.Close()
+		if code == 220 {
+			break
+		}
+		if i == 20 {
+			t.Fatalf("Result = %d, Expected 220", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// flakyListener fails to accept the first connection.
+type flakyListener struct {
+	net.Listener
+	failed bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if !l.failed {
+		l.failed = true
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.ECONNABORTED}
+	}
+	return l.Listener.Accept()
+}
+
+func TestServerAcceptError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Driver: MemoryDriver(), Logger: log.New(io.Discard, "", 0)}
+	errc := make(chan error, 1)
+	go func() { errc <- s.Serve(&flakyListener{Listener: ln}) }()
+	dial(t, ln.Addr().String(), 220)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+	if err := <-errc; err != ErrServerClosed {
+		t.Errorf("Result = %v, Expected %v", err, ErrServerClosed)
+	}
+}
+
+func TestServerShutdownTransfer(t *testing.T) {
+	s := &Server{DataTimeout: 10 * time.Second}
+	addr := startServer(t, s)
+	c := dial(t, addr, 220)
+	cmd(t, c, 331, "USER anonymous")
+	cmd(t, c, 230, "PASS guest@example.com")
+	d, _ := s.Driver("/")
+	f, err := d.Create("/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 32<<20))
+	f.Close()
+
+	// The client doesn't read the data.
+	conn := epsv(t, c, addr)
+	defer conn.Close()
+	cmd(t, c, 150, "RETR big")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Result = %v, Expected %v", err, context.DeadlineExceeded)
+	}
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Result = timeout, Expected the transfer to be closed")
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+package ftp
+
+import (
+	"path"
+	"strings"
+)
+
+// Clients see the home directory as "/" and every name is resolved to
+// a virtual path under it before it is passed to Driver.
+
+// vpath resolves name against the virtual working directory cwd.
+// ".." never goes above "/".
+func vpath(cwd, name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join(cwd, name)
+	}
+	return path.Clean("/" + name)
+}
+
+// abspath returns the virtual path of name given by the client.
+func (fh *ftpHandler) abspath(name string) string {
+	return vpath(fh.cwd, name)
+}
+
+// quotePath quotes the virtual path for 257 replies, doubling '"' as RFC 959.
+func quotePath(p string) string {
+	return "\"" + strings.Replace(p, "\"", "\"\"", -1) + "\""
+}
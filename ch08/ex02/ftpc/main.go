@@ -0,0 +1,192 @@
+// Copyright 2016 budougumi0617 All Rights Reserved.
+
+// ftpc is an interactive FTP client.
+//  ftpc [-user name] [-password password] [-active] host:port
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/budougumi0617/gopl/ch08/ex02/client"
+)
+
+const usage = `Commands:
+  ls [dir]               list the directory
+  cd dir                 change the remote directory
+  pwd                    print the remote directory
+  get remote [local]     download the file
+  put local [remote]     upload the file
+  mirror remote [local]  download the directory recursively, resuming partial files
+  mkdir dir              create the remote directory
+  rm name                delete the remote file
+  rename from to         rename the remote file
+  quit                   close the connection`
+
+func main() {
+	user := flag.String("user", "anonymous", "User name")
+	password := flag.String("password", "", "Password, prompted if empty")
+	active := flag.Bool("active", false, "Use active mode (PORT/EPRT) instead of passive mode")
+	flag.Parse()
+	log.SetFlags(0)
+	if flag.NArg() != 1 {
+		log.Fatal("usage: ftpc [-user name] [-password password] [-active] host:port")
+	}
+	in := bufio.NewScanner(os.Stdin)
+	c, err := client.Dial(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Active = *active
+	if *password == "" {
+		if *user == "anonymous" || *user == "ftp" {
+			*password = "guest@"
+		} else {
+			fmt.Print("Password: ")
+			in.Scan()
+			*password = in.Text()
+		}
+	}
+	if err = c.Login(*user, *password); err != nil {
+		log.Fatal(err)
+	}
+	defer c.Quit()
+
+	for fmt.Print("ftp> "); in.Scan(); fmt.Print("ftp> ") {
+		args := strings.Fields(in.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "bye" || args[0] == "close" {
+			return
+		}
+		if err := run(c, args[0], args[1:]); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// run executes the command of the client.
+func run(c *client.Conn, cmd string, args []string) error {
+	// arg returns args[i] or def if it is omitted.
+	arg := func(i int, def string) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return def
+	}
+	need := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("%s: missing arguments\n%s", cmd, usage)
+		}
+		return nil
+	}
+	switch cmd {
+	case "ls", "dir":
+		entries, err := c.List(arg(0, ""))
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', tabwriter.AlignRight)
+		for _, e := range entries {
+			name := e.Name
+			if e.Type == client.EntryDir {
+				name += "/"
+			}
+			fmt.Fprintf(w, "%d\t %s\t %s\n", e.Size, e.Time.Format("2006-01-02 15:04"), name)
+		}
+		return w.Flush()
+	case "cd":
+		if err := need(1); err != nil {
+			return err
+		}
+		return c.Cwd(args[0])
+	case "pwd":
+		dir, err := c.Pwd()
+		if err == nil {
+			fmt.Println(dir)
+		}
+		return err
+	case "get":
+		if err := need(1); err != nil {
+			return err
+		}
+		return get(c, args[0], arg(1, path.Base(args[0])))
+	case "put":
+		if err := need(1); err != nil {
+			return err
+		}
+		return put(c, args[0], arg(1, filepath.Base(args[0])))
+	case "mirror":
+		if err := need(1); err != nil {
+			return err
+		}
+		local := path.Base(args[0])
+		if local == "/" || local == "." || local == ".." {
+			local = "."
+		}
+		return c.Mirror(args[0], arg(1, local))
+	case "mkdir":
+		if err := need(1); err != nil {
+			return err
+		}
+		return c.Mkdir(args[0])
+	case "rm", "delete":
+		if err := need(1); err != nil {
+			return err
+		}
+		return c.Delete(args[0])
+	case "rename":
+		if err := need(2); err != nil {
+			return err
+		}
+		return c.Rename(args[0], args[1])
+	case "help", "?":
+		fmt.Println(usage)
+		return nil
+	}
+	return fmt.Errorf("%s: unknown command, try help", cmd)
+}
+
+func get(c *client.Conn, remote, local string) error {
+	r, err := c.Retr(remote)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(local)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		fmt.Printf("%d bytes received\n", n)
+	}
+	return err
+}
+
+func put(c *client.Conn, local, remote string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = c.Stor(remote, f); err == nil {
+		fmt.Printf("%s stored\n", remote)
+	}
+	return err
+}
@@ -2,36 +2,115 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/budougumi0617/gopl/ch08/ex02/ftp"
 )
 
-var op string
+var op, host string
 
-func initialize() {
+func initialize() *ftp.Server {
+	var pasvPorts, usersFile, passwd, driver, certFile, keyFile, xferlog string
+	var selfSigned bool
+	srv := &ftp.Server{Logger: log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile)}
 	flag.StringVar(&op, "port", "8000", "Port number") // Get -port option
+	flag.StringVar(&host, "host", "localhost", "Host address to listen on, empty for all interfaces")
+	flag.StringVar(&srv.Root, "root", "./", "Root directory of FTP server")
+	flag.StringVar(&pasvPorts, "pasv-ports", "", "Port range for passive mode, e.g. 50000-50100")
+	flag.StringVar(&srv.PublicAddr, "public-addr", "", "Address advertised in PASV replies")
+	flag.StringVar(&usersFile, "users", "", "User database file (JSON)")
+	flag.StringVar(&driver, "driver", "disk", "Storage driver, disk or memory")
+	flag.StringVar(&certFile, "tls-cert", "", "Certificate file for AUTH TLS")
+	flag.StringVar(&keyFile, "tls-key", "", "Private key file for AUTH TLS")
+	flag.BoolVar(&selfSigned, "tls-self-signed", false, "Use a self-signed certificate for AUTH TLS (for testing)")
+	flag.BoolVar(&srv.RequireTLS, "require-tls", false, "Refuse login without AUTH TLS")
+	flag.DurationVar(&srv.IdleTimeout, "idle-timeout", ftp.DefaultIdleTimeout, "Close idle sessions after this duration")
+	flag.DurationVar(&srv.DataTimeout, "data-timeout", ftp.DefaultDataTimeout, "Abort transfers stalled for this duration")
+	flag.IntVar(&srv.MaxSessions, "max-sessions", 0, "Maximum concurrent sessions, 0 means unlimited")
+	flag.IntVar(&srv.MaxSessionsPerIP, "max-sessions-per-ip", 0, "Maximum concurrent sessions from an IP address, 0 means unlimited")
+	flag.StringVar(&xferlog, "xferlog", "", "Append transfers to this file in the xferlog format")
+	flag.Int64Var(&srv.UploadRate, "upload-rate", 0, "Upload rate limit of each session in bytes/sec, 0 means unlimited")
+	flag.Int64Var(&srv.DownloadRate, "download-rate", 0, "Download rate limit of each session in bytes/sec, 0 means unlimited")
+	flag.Int64Var(&srv.TotalUploadRate, "total-upload-rate", 0, "Upload rate limit of all sessions in bytes/sec, 0 means unlimited")
+	flag.Int64Var(&srv.TotalDownloadRate, "total-download-rate", 0, "Download rate limit of all sessions in bytes/sec, 0 means unlimited")
+	flag.StringVar(&passwd, "hash-password", "", "Print the hash of the password for the user database and exit")
 	flag.Parse()
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-}
-
-func main() {
-	initialize()
-	initCmdMap()
-	listener, err := net.Listen("tcp", "localhost:"+op)
+	if passwd != "" {
+		h, err := ftp.HashPassword(passwd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(h)
+		os.Exit(0)
+	}
+	srv.Addr = net.JoinHostPort(host, op)
+	switch driver {
+	case "disk":
+		srv.Driver = ftp.DiskDriver(srv.Root)
+	case "memory":
+		srv.Driver = ftp.MemoryDriver()
+	default:
+		log.Fatalf("unknown driver %q", driver)
+	}
+	var err error
+	if usersFile != "" {
+		if srv.Users, err = ftp.LoadUsers(usersFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch {
+	case certFile != "" || keyFile != "":
+		srv.TLSConfig, err = ftp.LoadTLSConfig(certFile, keyFile)
+	case selfSigned:
+		srv.TLSConfig, err = ftp.SelfSignedTLSConfig()
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	for {
-		conn, err := listener.Accept()
+	if srv.RequireTLS && srv.TLSConfig == nil {
+		log.Fatal("-require-tls needs -tls-cert and -tls-key, or -tls-self-signed")
+	}
+	if srv.PassiveMinPort, srv.PassiveMaxPort, err = ftp.ParsePortRange(pasvPorts); err != nil {
+		log.Fatal(err)
+	}
+	if xferlog != "" {
+		f, err := os.OpenFile(xferlog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
-			log.Print(err) // e.g., connection aborted
-			continue
+			log.Fatal(err)
 		}
-		log.Printf("Connect from %v\n", conn.RemoteAddr())
-		fh := newFtpHandler(conn)
-		go fh.execute()
+		srv.TransferLog = f
+	}
+	return srv
+}
 
+func main() {
+	srv := initialize()
+
+	// Finish in-flight transfers on SIGINT or SIGTERM.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Print("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != ftp.ErrServerClosed {
+		log.Fatal(err)
 	}
+	// Wait for Shutdown to close the sessions.
+	srv.Shutdown(context.Background())
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Settings of password hashing and nickname protection.
+var (
+	hashIterations = 200000           // PBKDF2 iterations of new accounts
+	minPassword    = 6                // minimum length of passwords
+	graceTime      = 30 * time.Second // time to /identify before renamed
+	failDelay      = time.Second      // refusal of /identify after a wrong password, doubled by each failure
+	maxFailDelay   = 5 * time.Minute  // maximum of failDelay
+)
+
+// hashSlots limits the passwords hashed at once, so that clients can't take
+// all CPUs by /register and /identify.
+var hashSlots = make(chan struct{}, runtime.NumCPU())
+
+// hashing runs f, which hashes a password, when a slot is free.
+func hashing(f func()) {
+	hashSlots <- struct{}{}
+	defer func() { <-hashSlots }()
+	f()
+}
+
+// failure is the wrong passwords of /identify for a name.
+type failure struct {
+	count int
+	until time.Time // /identify is refused until then
+}
+
+// delay returns the time to refuse /identify after count failures.
+func (f failure) delay() time.Duration {
+	d := failDelay
+	for i := 1; i < f.count && d < maxFailDelay; i++ {
+		d *= 2
+	}
+	if d > maxFailDelay {
+		d = maxFailDelay
+	}
+	return d
+}
+
+// account is a registered nickname. The password is hashed by PBKDF2 with
+// SHA-256.
+type account struct {
+	Salt       []byte    `json:"salt"`
+	Hash       []byte    `json:"hash"`
+	Iterations int       `json:"iterations"`
+	Registered time.Time `json:"registered"`
+}
+
+func hashPassword(password string, salt []byte, iterations int) []byte {
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, 32)
+	if err != nil {
+		panic(err) // only for invalid parameters
+	}
+	return key
+}
+
+// newAccount hashes the password with a new salt.
+func newAccount(password string) account {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return account{
+		Salt:       salt,
+		Hash:       hashPassword(password, salt, hashIterations),
+		Iterations: hashIterations,
+		Registered: time.Now(),
+	}
+}
+
+// verify reports whether password is the password of a.
+func (a account) verify(password string) bool {
+	hash := hashPassword(password, a.Salt, a.Iterations)
+	return subtle.ConstantTimeCompare(hash, a.Hash) == 1
+}
+
+// accountStore is the registered nicknames by the lower case name. It is
+// used only by broadcaster, and saved to the file on each change.
+type accountStore struct {
+	filename string // "" if not persisted
+	accounts map[string]account
+}
+
+// accountFile is the JSON format of the accounts file.
+type accountFile struct {
+	Accounts map[string]account `json:"accounts"`
+}
+
+// loadAccounts reads the accounts from filename. A missing file has no
+// accounts.
+func loadAccounts(filename string) (*accountStore, error) {
+	s := &accountStore{filename: filename, accounts: map[string]account{}}
+	if filename == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f accountFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for name, a := range f.Accounts {
+		s.accounts[strings.ToLower(name)] = a
+	}
+	return s, nil
+}
+
+// save writes the accounts to the file readable only by the owner.
+func (s *accountStore) save() error {
+	if s.filename == "" {
+		return nil
+	}
+	data, _ := json.MarshalIndent(accountFile{s.accounts}, "", "  ")
+	tmp := s.filename + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
+
+func (s *accountStore) lookup(name string) (account, bool) {
+	a, ok := s.accounts[strings.ToLower(name)]
+	return a, ok
+}
+
+// register handles "/register password". Hashing runs in another
+// goroutine, and the result is applied by broadcaster.
+func (h *hub) register(cli *client, password string) {
+	if len(password) < minPassword {
+		send(cli, fmt.Sprintf("Usage: /register password, at least %d characters", minPassword))
+		return
+	}
+	name := cli.Name
+	if _, ok := h.accounts.lookup(name); ok {
+		send(cli, "Name "+name+" is already registered. /identify password")
+		return
+	}
+	if cli.hashing {
+		send(cli, "Your previous password is still being checked")
+		return
+	}
+	cli.hashing = true
+	go func() {
+		var a account
+		hashing(func() { a = newAccount(password) })
+		h.actions <- func() {
+			cli.hashing = false
+			if !h.clients[cli] {
+				return // left while hashing
+			}
+			key := strings.ToLower(name)
+			if _, ok := h.accounts.accounts[key]; ok {
+				send(cli, "Name "+name+" is already registered. /identify password")
+				return
+			}
+			h.accounts.accounts[key] = a
+			if err := h.accounts.save(); err != nil {
+				log.Print(err)
+				send(cli, "Failed to save the account")
+			}
+			cli.identified = key
+			send(cli, "Registered "+name+". Use /identify password when you come back.")
+		}
+	}()
+}
+
+// identify handles "/identify password" for the current name of cli.
+// After a wrong password, /identify of the name is refused for a while
+// against guessing, even from other clients.
+func (h *hub) identify(cli *client, password string) {
+	name := cli.Name
+	key := strings.ToLower(name)
+	a, ok := h.accounts.lookup(name)
+	if !ok {
+		send(cli, "Name "+name+" is not registered. /register password")
+		return
+	}
+	if cli.hashing {
+		send(cli, "Your previous password is still being checked")
+		return
+	}
+	if rest := time.Until(h.failures[key].until); rest > 0 {
+		send(cli, fmt.Sprintf("Too many wrong passwords for %s. Try again in %v", name, rest.Round(time.Second)))
+		return
+	}
+	cli.hashing = true
+	go func() {
+		var ok bool
+		hashing(func() { ok = a.verify(password) })
+		h.actions <- func() {
+			cli.hashing = false
+			if !h.clients[cli] {
+				return // left while hashing
+			}
+			if !ok {
+				f := h.failures[key]
+				f.count++
+				f.until = time.Now().Add(f.delay())
+				h.failures[key] = f
+				log.Printf("failed /identify %s from %s", name, cli.ip)
+				send(cli, "Wrong password for "+name)
+				return
+			}
+			delete(h.failures, key)
+			cli.identified = key
+			send(cli, "You are identified as "+name)
+		}
+	}()
+}
+
+// protect asks cli to identify if its name is registered, and renames cli
+// to a guest name after graceTime unless it has identified by then.
+func (h *hub) protect(cli *client) {
+	name := cli.Name
+	key := strings.ToLower(name)
+	if _, ok := h.accounts.lookup(name); !ok || cli.identified == key || cli.Out == nil {
+		return
+	}
+	send(cli, fmt.Sprintf("Name %s is registered. /identify password within %v, or you will be renamed.", name, graceTime))
+	time.AfterFunc(graceTime, func() {
+		h.actions <- func() {
+			if !h.clients[cli] || cli.Name != name || cli.identified == key {
+				return
+			}
+			guest := h.guestName()
+			send(cli, "You are renamed to "+guest+" because "+name+" is registered")
+			h.rename(cli, guest)
+		}
+	})
+}
+
+// guestName returns an unused name such as "Guest1".
+func (h *hub) guestName() string {
+	for {
+		h.guests++
+		name := fmt.Sprintf("Guest%d", h.guests)
+		if h.nicks[strings.ToLower(name)] == nil && !h.bans.bannedNick(name) {
+			if _, ok := h.accounts.lookup(name); !ok {
+				return name
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitAction runs the next action of broadcaster such as password hashing.
+func waitAction(t *testing.T, h *hub) {
+	select {
+	case f := <-h.actions:
+		f()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Result = timeout, Expected an action")
+	}
+}
+
+func TestAccount(t *testing.T) {
+	defer func(n int) { hashIterations = n }(hashIterations)
+	hashIterations = 1000
+
+	a := newAccount("secret")
+	if !a.verify("secret") || a.verify("Secret") || a.verify("") {
+		t.Errorf("Result = false, Expected only the password to be verified")
+	}
+	if b := newAccount("secret"); reflect.DeepEqual(a.Hash, b.Hash) {
+		t.Errorf("Result = the same hash, Expected different salts")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func(n int, d, f time.Duration) { hashIterations, graceTime, failDelay = n, d, f }(hashIterations, graceTime, failDelay)
+	hashIterations, graceTime, failDelay = 1000, 200*time.Millisecond, 0
+
+	filename := filepath.Join(t.TempDir(), "accounts.json")
+	h := newHub(10, 0)
+	var err error
+	if h.accounts, err = loadAccounts(filename); err != nil {
+		t.Fatal(err)
+	}
+	alice, aliceOut := newTestClient(h, "alice")
+	received(aliceOut)
+	h.command(command{from: alice, name: "register", arg: "short"})
+	h.command(command{from: alice, name: "register", arg: "wonderland"})
+	waitAction(t, h)
+	h.command(command{from: alice, name: "register", arg: "wonderland"})
+	expect := []string{
+		"Usage: /register password, at least 6 characters",
+		"Registered alice. Use /identify password when you come back.",
+		"Name alice is already registered. /identify password",
+	}
+	if got := received(aliceOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil || strings.Contains(string(data), "wonderland") {
+		t.Errorf("Result = %s, %v, Expected the hashed password", data, err)
+	}
+	h.quit(alice, "")
+	h.leave(alice)
+
+	// Someone else takes the name, and is renamed after the grace time.
+	h.accounts, _ = loadAccounts(filename)
+	mallory, malloryOut := newTestClient(h, "ALICE")
+	received(malloryOut)
+	h.protect(mallory)
+	h.command(command{from: mallory, name: "identify", arg: "guess"})
+	waitAction(t, h)
+	waitAction(t, h)
+	expect = []string{
+		"Name ALICE is registered. /identify password within 200ms, or you will be renamed.",
+		"Wrong password for ALICE",
+		"You are renamed to Guest1 because ALICE is registered",
+		"#lobby ALICE is now known as Guest1",
+	}
+	if got := received(malloryOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	// The owner identifies in time.
+	h.command(command{from: mallory, name: "nick", arg: "alice"})
+	h.command(command{from: mallory, name: "identify", arg: "wonderland"})
+	waitAction(t, h)
+	waitAction(t, h)
+	if mallory.Name != "alice" || mallory.identified != "alice" {
+		t.Errorf("Result = %s identified as %q, Expected alice", mallory.Name, mallory.identified)
+	}
+}
+
+func TestIdentifyLimits(t *testing.T) {
+	defer func(n int, f time.Duration) { hashIterations, failDelay = n, f }(hashIterations, failDelay)
+	hashIterations, failDelay = 1000, time.Minute
+
+	h := newHub(10, 0)
+	h.accounts.accounts["bob"] = newAccount("secret")
+	bob, bobOut := newTestClient(h, "bob")
+	received(bobOut)
+	h.command(command{from: bob, name: "identify", arg: "guess"})
+	h.command(command{from: bob, name: "identify", arg: "secret"})
+	waitAction(t, h)
+	h.command(command{from: bob, name: "identify", arg: "secret"})
+	expect := []string{
+		"Your previous password is still being checked",
+		"Wrong password for bob",
+		"Too many wrong passwords for bob. Try again in 1m0s",
+	}
+	if got := received(bobOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	if bob.identified != "" {
+		t.Errorf("Result = %q, Expected bob not to be identified", bob.identified)
+	}
+
+	// The delay doubles up to maxFailDelay.
+	failDelay = time.Second
+	var tests = []struct {
+		count  int
+		expect time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{9, 256 * time.Second},
+		{10, maxFailDelay},
+		{1000, maxFailDelay},
+	}
+	for _, test := range tests {
+		if got := (failure{count: test.count}).delay(); got != test.expect {
+			t.Errorf("delay(%d) = %v, Expected %v", test.count, got, test.expect)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	if _, err := tlsConfig("cert.pem", ""); err == nil {
+		t.Errorf("Result = nil, Expected an error without the key")
+	}
+	config, err := tlsConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte(line))
+	}()
+
+	// The self-signed certificate is valid for localhost.
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello\n"))
+	if line, err := bufio.NewReader(conn).ReadString('\n'); line != "hello\n" {
+		t.Errorf("Result = %q, %v, Expected hello", line, err)
+	}
+}
+
+// A client leaving while its password is hashed must not crash the server.
+func TestIdentifyAfterLeaving(t *testing.T) {
+	defer func(n int) { hashIterations = n }(hashIterations)
+	hashIterations = 1000
+
+	h := newHub(10, 0)
+	h.accounts.accounts["alice"] = newAccount("wonderland")
+	for _, test := range []struct{ nick, name string }{{"bob", "register"}, {"alice", "identify"}} {
+		cli, out := newTestClient(h, test.nick)
+		received(out)
+		h.command(command{from: cli, name: test.name, arg: "wonderland"})
+		// as the leaving case of broadcaster
+		h.quit(cli, "")
+		h.leave(cli)
+		close(out)
+		cli.Out = nil
+		waitAction(t, h)
+		if cli.identified != "" {
+			t.Errorf("Result = %q, Expected /%s not applied after leaving", cli.identified, test.name)
+		}
+	}
+}
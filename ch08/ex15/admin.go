@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counters of sendRaw. They are updated atomically.
+var (
+	droppedTotal int64 // messages dropped for slow clients
+	slowKicked   int64 // clients disconnected by the slow policy
+)
+
+// writers is the number of running clientWriter and ircWriter. Shutdown
+// waits for them to send the last messages.
+var writers sync.WaitGroup
+
+// shutdownTimeout is the time to wait for clients to be closed on shutdown.
+var shutdownTimeout = 5 * time.Second
+
+// meter counts events in the last minute by the second.
+type meter struct {
+	total  int64
+	counts [60]int64
+	last   int64 // Unix time of the last count
+}
+
+// advance clears the counts older than a minute.
+func (m *meter) advance(now time.Time) {
+	s := now.Unix()
+	if s <= m.last {
+		return
+	}
+	if s-m.last >= int64(len(m.counts)) {
+		m.counts = [60]int64{}
+	} else {
+		for t := m.last + 1; t <= s; t++ {
+			m.counts[t%int64(len(m.counts))] = 0
+		}
+	}
+	m.last = s
+}
+
+func (m *meter) add(now time.Time) {
+	m.advance(now)
+	m.counts[m.last%int64(len(m.counts))]++
+	m.total++
+}
+
+// rate returns the events per second in the last minute.
+func (m *meter) rate(now time.Time) float64 {
+	m.advance(now)
+	var sum int64
+	for _, n := range m.counts {
+		sum += n
+	}
+	return float64(sum) / float64(len(m.counts))
+}
+
+// stats is the JSON of the admin /stats endpoint.
+type stats struct {
+	Uptime          string        `json:"uptime"`
+	UptimeSeconds   float64       `json:"uptime_seconds"`
+	Clients         []clientStats `json:"clients"`
+	Rooms           []roomStats   `json:"rooms"`
+	Messages        int64         `json:"messages"`            // messages said since start
+	MessageRate     float64       `json:"messages_per_second"` // average of the last minute
+	Dropped         int64         `json:"dropped"`             // messages dropped for slow clients
+	SlowDisconnects int64         `json:"slow_disconnects"`    // clients disconnected by -slow
+	Servers         []string      `json:"servers,omitempty"`   // linked servers
+}
+
+type clientStats struct {
+	Name     string   `json:"name"`
+	Protocol string   `json:"protocol"` // plain, web, irc, remote or bot
+	Server   string   `json:"server,omitempty"`
+	IP       string   `json:"ip,omitempty"`
+	Rooms    []string `json:"rooms"`
+	Op       bool     `json:"op,omitempty"`
+	Away     string   `json:"away,omitempty"`
+	Pending  int      `json:"pending"` // messages waiting in Out
+	Dropped  int      `json:"dropped"` // dropped messages not notified yet
+}
+
+type roomStats struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+	Topic   string `json:"topic,omitempty"`
+}
+
+// stats returns the current statistics. It must be called by broadcaster.
+func (h *hub) stats(now time.Time) stats {
+	uptime := now.Sub(started)
+	s := stats{
+		Uptime:          uptime.Round(time.Second).String(),
+		UptimeSeconds:   uptime.Seconds(),
+		Clients:         []clientStats{},
+		Rooms:           []roomStats{},
+		Messages:        h.traffic.total,
+		MessageRate:     h.traffic.rate(now),
+		Dropped:         atomic.LoadInt64(&droppedTotal),
+		SlowDisconnects: atomic.LoadInt64(&slowKicked),
+	}
+	for cli := range h.clients {
+		c := clientStats{
+			Name:     cli.Name,
+			Protocol: protocol(cli),
+			Server:   cli.server,
+			IP:       cli.ip,
+			Rooms:    sortedKeys(cli.rooms),
+			Op:       cli.op,
+			Away:     cli.away,
+			Pending:  len(cli.Out),
+			Dropped:  cli.dropped,
+		}
+		if c.Rooms == nil {
+			c.Rooms = []string{}
+		}
+		s.Clients = append(s.Clients, c)
+	}
+	sort.Slice(s.Clients, func(i, j int) bool { return s.Clients[i].Name < s.Clients[j].Name })
+	for room, members := range h.rooms {
+		s.Rooms = append(s.Rooms, roomStats{Name: room, Members: len(members), Topic: h.topics[room]})
+	}
+	sort.Slice(s.Rooms, func(i, j int) bool { return s.Rooms[i].Name < s.Rooms[j].Name })
+	if h.network != nil {
+		for server := range h.network.servers {
+			s.Servers = append(s.Servers, server)
+		}
+		sort.Strings(s.Servers)
+	}
+	return s
+}
+
+func protocol(cli *client) string {
+	switch {
+	case cli.bot:
+		return "bot"
+	case cli.server != "":
+		return "remote"
+	case cli.irc:
+		return "irc"
+	}
+	if _, ok := cli.conn.(*wsConn); ok {
+		return "web"
+	}
+	return "plain"
+}
+
+// adminHandler serves the statistics of h as JSON at /stats, and sends a
+// request to shutdown on POST /shutdown. Requests must have the header
+// "Authorization: Bearer token", so that web pages can't shut down the
+// server by cross-site requests even on loopback. An empty token refuses
+// all requests.
+func adminHandler(h *hub, token string, shutdown chan<- string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		result := make(chan stats, 1)
+		select {
+		case h.actions <- func() { result <- h.stats(time.Now()) }:
+		case <-time.After(timeout):
+			http.Error(w, "broadcaster is busy", http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case s := <-result:
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(s)
+		case <-time.After(timeout):
+			http.Error(w, "broadcaster is busy", http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		select {
+		case shutdown <- "admin request from " + r.RemoteAddr:
+		default: // already shutting down
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("shutting down\n"))
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// shutdown tells the local clients that the server is shutting down, and
+// stops reading from them. They leave after receiving the rest of their
+// messages.
+func (h *hub) shutdown() {
+	for cli := range h.clients {
+		if cli.Out == nil {
+			continue
+		}
+		if cli.irc {
+			sendRaw(cli, "ERROR :Closing link (Server shutting down)")
+		} else {
+			send(cli, "*** Server is shutting down")
+		}
+		if cli.conn != nil {
+			cli.conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// closeAll closes the listeners, and then the clients by broadcaster. It
+// returns when the clients have been closed or after shutdownTimeout.
+func closeAll(h *hub, listeners []net.Listener) {
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	h.actions <- h.shutdown
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Print("shutdown: some clients are not closed")
+	}
+}
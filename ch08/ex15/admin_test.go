@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeter(t *testing.T) {
+	start := time.Unix(1000000, 0)
+	var m meter
+	for i := 0; i < 30; i++ {
+		m.add(start.Add(time.Duration(i) * time.Second))
+		m.add(start.Add(time.Duration(i) * time.Second))
+	}
+	var tests = []struct {
+		after  time.Duration
+		expect float64
+	}{
+		{29 * time.Second, 1},
+		{59 * time.Second, 1},
+		{60 * time.Second, 58.0 / 60},
+		{74 * time.Second, 30.0 / 60},
+		{2 * time.Minute, 0},
+	}
+	for _, test := range tests {
+		if got := m.rate(start.Add(test.after)); got != test.expect {
+			t.Errorf("rate after %v = %v, Expected %v", test.after, got, test.expect)
+		}
+	}
+	if m.total != 60 {
+		t.Errorf("Result = %d, Expected 60", m.total)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	h := newHub(10, 0)
+	alice, aliceOut := newTestClient(h, "alice")
+	_, bobOut := newTestClient(h, "bob")
+	h.join(alice, "#go")
+	h.topics["#go"] = "Gophers"
+	h.say(alice, "#go", "hello")
+	h.msg(alice, "bob", "hi")
+	received(aliceOut)
+	received(bobOut)
+
+	shutdown := make(chan string, 1)
+	srv := httptest.NewServer(adminHandler(h, "secret", shutdown))
+	defer srv.Close()
+	// do sends the request with the token.
+	do := func(method, path, token string) (*http.Response, error) {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return http.DefaultClient.Do(req)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case f := <-h.actions:
+				f()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var tests = []struct {
+		method, path, token string
+	}{
+		{"GET", "/stats", ""},
+		{"GET", "/stats", "wrong"},
+		{"POST", "/shutdown", ""},
+		{"POST", "/shutdown", "secre"},
+	}
+	for _, test := range tests {
+		resp, err := do(test.method, test.path, test.token)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s with %q = %v, Expected %d", test.method, test.path, test.token, err, http.StatusUnauthorized)
+			continue
+		}
+		resp.Body.Close()
+	}
+	// Without the token, even a cross-site form POST to loopback is
+	// refused.
+	noToken := httptest.NewServer(adminHandler(h, "", shutdown))
+	defer noToken.Close()
+	if resp, err := http.Post(noToken.URL+"/shutdown", "application/x-www-form-urlencoded", nil); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Result = %v, Expected %d without -admin-token", err, http.StatusUnauthorized)
+	}
+	select {
+	case reason := <-shutdown:
+		t.Errorf("Result = %q, Expected no shutdown without the token", reason)
+	default:
+	}
+
+	resp, err := do("GET", "/stats", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s stats
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectClients := []clientStats{
+		{Name: "alice", Protocol: "plain", Rooms: []string{"#go", lobby}},
+		{Name: "bob", Protocol: "plain", Rooms: []string{lobby}},
+	}
+	if !reflect.DeepEqual(s.Clients, expectClients) {
+		t.Errorf("Result = %+v, Expected %+v", s.Clients, expectClients)
+	}
+	expectRooms := []roomStats{{"#go", 1, "Gophers"}, {lobby, 2, ""}}
+	if !reflect.DeepEqual(s.Rooms, expectRooms) {
+		t.Errorf("Result = %+v, Expected %+v", s.Rooms, expectRooms)
+	}
+	if s.Messages != 2 || s.MessageRate <= 0 || s.UptimeSeconds <= 0 {
+		t.Errorf("Result = %d messages, %v/s, %vs, Expected 2 messages", s.Messages, s.MessageRate, s.UptimeSeconds)
+	}
+
+	if resp, err := do("GET", "/shutdown", "secret"); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Result = %v, Expected %d for GET /shutdown", err, http.StatusMethodNotAllowed)
+	}
+	resp, err = do("POST", "/shutdown", "secret")
+	if err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Result = %v, Expected %d", err, http.StatusAccepted)
+	}
+	select {
+	case reason := <-shutdown:
+		if !strings.HasPrefix(reason, "admin request") {
+			t.Errorf("Result = %q, Expected an admin request", reason)
+		}
+	default:
+		t.Errorf("Result = no request, Expected shutdown")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	h := newHub(10, 0)
+	server, conn := net.Pipe()
+	defer conn.Close()
+	alice, aliceOut := newTestClient(h, "alice")
+	alice.conn = server
+	h.newBot("echobot")
+	received(aliceOut)
+
+	h.shutdown()
+	if got := received(aliceOut); !reflect.DeepEqual(got, []string{"*** Server is shutting down"}) {
+		t.Errorf("Result = %q, Expected the notice", got)
+	}
+	// The reader of the client ends.
+	if _, err := bufio.NewReader(server).ReadString('\n'); err == nil {
+		t.Errorf("Result = nil, Expected a timeout")
+	}
+}
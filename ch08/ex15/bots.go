@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/budougumi0617/gopl/ch07/ex16/eval"
+)
+
+// nopPlugin ignores all events. Bots embed it and override some methods.
+type nopPlugin struct{}
+
+func (nopPlugin) OnJoin(room, name string)          {}
+func (nopPlugin) OnLeave(room, name string)         {}
+func (nopPlugin) OnMessage(room, name, text string) {}
+
+// echoBot repeats "!echo text".
+type echoBot struct {
+	nopPlugin
+	bot *Bot
+}
+
+func newEchoBot(b *Bot) Plugin { return &echoBot{bot: b} }
+
+func (e *echoBot) OnMessage(room, name, text string) {
+	if strings.HasPrefix(text, "!echo ") {
+		e.bot.Say(room, strings.TrimSpace(text[len("!echo "):]))
+	}
+}
+
+// calcBot evaluates "!calc expr" such as "!calc sqrt(2) * 3".
+type calcBot struct {
+	nopPlugin
+	bot *Bot
+}
+
+func newCalcBot(b *Bot) Plugin { return &calcBot{bot: b} }
+
+func (c *calcBot) OnMessage(room, name, text string) {
+	if !strings.HasPrefix(text, "!calc ") {
+		return
+	}
+	input := strings.TrimSpace(text[len("!calc "):])
+	result, err := calc(input)
+	if err != nil {
+		c.bot.Say(room, name+": "+err.Error())
+		return
+	}
+	c.bot.Say(room, fmt.Sprintf("%s: %s = %g", name, input, result))
+}
+
+// calc evaluates the expression without variables.
+func calc(input string) (float64, error) {
+	expr, err := eval.Parse(input)
+	if err != nil {
+		return 0, err
+	}
+	vars := map[eval.Var]bool{}
+	if err := expr.Check(vars); err != nil {
+		return 0, err
+	}
+	if len(vars) > 0 {
+		var names []string
+		for v := range vars {
+			names = append(names, string(v))
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("undefined: %s", strings.Join(names, ", "))
+	}
+	return expr.Eval(eval.Env{}), nil
+}
+
+// titleBot says the titles of the web pages of the URLs in messages.
+type titleBot struct {
+	nopPlugin
+	bot    *Bot
+	client *http.Client
+}
+
+func newTitleBot(b *Bot) Plugin {
+	// Users must not make the bot read private servers such as the
+	// admin pages on localhost.
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}
+	return &titleBot{bot: b, client: &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}}
+}
+
+var errPrivate = errors.New("private address")
+
+// publicOnly refuses to connect to loopback, private and link-local
+// addresses.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errPrivate
+	}
+	return nil
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+const maxURLs = 3 // URLs looked up in a message
+
+func (t *titleBot) OnMessage(room, name, text string) {
+	for _, url := range urlPattern.FindAllString(text, maxURLs) {
+		url := url
+		t.bot.Go(func() {
+			if title, err := t.title(url); err == nil && title != "" {
+				t.bot.Say(room, "Title: "+title)
+			}
+		})
+	}
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// title returns the title of the HTML page at url.
+func (t *titleBot) title(url string) (string, error) {
+	resp, err := t.client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		return "", fmt.Errorf("%s: not HTML but %s", url, ct)
+	}
+	// The title is in the head of the page.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	m := titlePattern.FindSubmatch(data)
+	if m == nil {
+		return "", nil
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if r := []rune(title); len(r) > 200 {
+		title = string(r[:200]) + "..."
+	}
+	return title, nil
+}
@@ -3,9 +3,17 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,109 +22,369 @@ const timeout = 10 * time.Second
 type client struct {
 	Out  chan<- string // outgoing message channel
 	Name string
+	conn net.Conn
+	ip   string // IP address of conn
+	irc  bool   // speaking IRC instead of plain text
+	user string // user name of IRC USER command
+
+	server     string // server of a remote client, "" if local
+	remoteName string // name of a remote client on its server
+	bot        bool   // run by a plugin
+	identified string // lower case name identified by the password
+
+	// The following fields are owned by broadcaster.
+	rooms   map[string]bool // joined rooms
+	current string          // room where messages are said, "" if none
+	away    string          // reason of /away, "" if present
+	dropped int             // messages dropped since the last notice
+	kicked  bool            // disconnected by the slow policy or an operator
+	op      bool            // operator
+	hashing bool            // a password of /register or /identify is being hashed
+}
+
+// entry is a client entering the chat. result receives "" if the client is
+// accepted, otherwise the reason.
+type entry struct {
+	cli    *client
+	result chan string
+}
+
+// message is a line said by a client in the room, or in its current room
+// if room is "".
+type message struct {
+	from *client
+	room string
+	text string
+}
+
+// command is a slash command of a client such as "/join #go".
+type command struct {
+	from *client
+	name string // command name without "/" in lower case
+	arg  string
+	room string // target room of IRC TOPIC, "" for the current room
 }
 
 var (
-	entering = make(chan client)
-	leaving  = make(chan client)
-	messages = make(chan string) // all incoming client messages
+	entering = make(chan entry)
+	leaving  = make(chan *client)
+	messages = make(chan message) // all incoming client messages
+	commands = make(chan command) // all incoming slash commands
+	notices  = make(chan message) // notices to the sender itself, such as flood warnings
 )
 
-func broadcaster() {
-	clients := make(map[client]bool) // all connected clients
+func broadcaster(h *hub) {
+	var linkIn <-chan linkEvent
+	var heartbeat <-chan time.Time
+	if h.network != nil {
+		linkIn = h.network.in
+		heartbeat = time.NewTicker(linkInterval).C
+	}
 	for {
 		select {
 		case msg := <-messages:
-			// Broadcast incoming message to all
-			// clients' outgoing message channels.
-			for cli := range clients {
-				select {
-				case cli.Out <- msg:
-				default:
-					// Skip client if it's reading messages slowly.
-				}
-			}
+			// Broadcast incoming message to the members of the
+			// room.
+			h.say(msg.from, msg.room, msg.text)
 
-		case cli := <-entering:
-			clients[cli] = true
-			cli.Out <- "Present:"
-			for c := range clients {
-				cli.Out <- c.Name
+		case cmd := <-commands:
+			h.command(cmd)
+
+		case n := <-notices:
+			send(n.from, n.text)
+
+		case e := <-entering:
+			reason := h.enter(e.cli)
+			e.result <- reason
+			if reason != "" {
+				continue
+			}
+			if e.cli.irc {
+				welcome(e.cli)
+			} else {
+				send(e.cli, "You are "+e.cli.Name)
 			}
+			h.join(e.cli, lobby)
+			h.protect(e.cli)
 
 		case cli := <-leaving:
-			delete(clients, cli)
+			h.quit(cli, "")
+			h.leave(cli)
 			close(cli.Out)
+			// Actions queued before leaving, such as password
+			// hashing, may still send to cli.
+			cli.Out = nil
+
+		case le := <-linkIn:
+			h.handleLink(le)
+
+		case now := <-heartbeat:
+			h.heartbeat(now)
+
+		case f := <-h.actions:
+			// Actions of bots, password hashing and timers.
+			f()
 		}
 	}
 }
 
+// parseCommand parses a slash command such as "/join #go". A line starting
+// with "//" is a message starting with "/".
+func parseCommand(cli *client, line string) (command, bool) {
+	if !strings.HasPrefix(line, "/") || strings.HasPrefix(line, "//") {
+		return command{}, false
+	}
+	f := strings.SplitN(line[1:], " ", 2)
+	cmd := command{from: cli, name: strings.ToLower(f[0])}
+	if len(f) == 2 {
+		cmd.arg = strings.TrimSpace(f[1])
+	}
+	return cmd, true
+}
+
+// serve handles the connections accepted on ln until ln is closed.
+func serve(ln net.Listener, handle func(net.Conn)) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		go handle(conn)
+	}
+}
+
 func handleConn(conn net.Conn) {
-	out := make(chan string, 10) // outgoing client messages
+	out := make(chan string, slow.buffer) // outgoing client messages
+	writers.Add(1)
 	go clientWriter(conn, out)
-	in := make(chan string) // incoming client messages
-	go clientReader(conn, in)
+	in := make(chan string)   // incoming client messages
+	warn := make(chan string) // flood warnings of clientReader
+	go clientReader(conn, in, warn)
 
-	var who string
+	var cli *client
 	nameTimer := time.NewTimer(timeout)
 	out <- "Enter your name:"
-	select {
-	case name := <-in:
-		who = name
-	case <-nameTimer.C:
-		conn.Close()
-		return
-	}
-	cli := client{out, who}
-	out <- "You are " + who
-	messages <- who + " has arrived"
-	entering <- cli
+	for cli == nil {
+		select {
+		case name, ok := <-in:
+			if !ok {
+				// clientWriter sends the warning of flooding if any,
+				// and then closes conn.
+				conn.SetWriteDeadline(time.Now().Add(timeout))
+				close(out)
+				return
+			}
+			cli = &client{Out: out, Name: name, conn: conn, ip: remoteIP(conn)}
+			result := make(chan string)
+			entering <- entry{cli, result}
+			if reason := <-result; reason != "" {
+				cli = nil
+				out <- reason + " Enter another name:"
+			}
+		case w := <-warn:
+			out <- w
+		case <-nameTimer.C:
+			close(out)
+			conn.Close()
+			return
+		}
+	}
 	idle := time.NewTimer(timeout)
 
 Loop:
 	for {
 		select {
-		case msg := <-in:
-			messages <- who + ": " + msg
+		case msg, ok := <-in:
+			if !ok {
+				break Loop
+			}
+			if cmd, ok := parseCommand(cli, msg); ok {
+				commands <- cmd
+			} else {
+				messages <- message{from: cli, text: strings.TrimPrefix(msg, "/")}
+			}
 			idle.Reset(timeout)
+		case w := <-warn:
+			notices <- message{from: cli, text: w}
 		case <-idle.C:
 			conn.Close()
 			break Loop
 		}
 	}
 
+	// clientWriter sends the rest of the messages, and then closes conn.
+	conn.SetWriteDeadline(time.Now().Add(timeout))
 	leaving <- cli
-	messages <- who + " has left"
-	conn.Close()
 }
 
 func clientWriter(conn net.Conn, ch <-chan string) {
+	defer writers.Done()
+	defer conn.Close()
 	for msg := range ch {
 		fmt.Fprintln(conn, msg) // NOTE: ignoring network errors
 	}
 }
 
-func clientReader(conn net.Conn, ch chan<- string) {
+// clientReader sends lines read from conn to ch, and closes ch at the end.
+// Lines over the rate limit are dropped with a warning sent to warn, and
+// reading ends if the client keeps flooding. The handler of the client
+// sends the warnings through Out, so that only the writer writes to conn.
+func clientReader(conn net.Conn, ch, warn chan<- string) {
+	defer close(ch)
+	b := newBucket(floodRate, floodBurst)
+	dropped := 0
 	input := bufio.NewScanner(conn)
 	for input.Scan() {
+		now := time.Now()
+		if dropped > 0 && b.full(now) {
+			dropped = 0
+		}
+		if !b.allow(now) {
+			dropped++
+			switch {
+			case dropped > floodLimit:
+				warn <- "*** Disconnected for flooding"
+				return
+			case dropped == 1:
+				warn <- "*** You are sending too fast. Messages are dropped until you slow down."
+			}
+			continue
+		}
 		ch <- input.Text()
 	}
 	// NOTE: ignoring potential errors from input.Err()
 }
 
 func main() {
-	listener, err := net.Listen("tcp", "localhost:8000")
-	if err != nil {
+	addr := flag.String("addr", "localhost:8000", "Address of plain text clients")
+	historySize := flag.Int("history", 100, "Number of messages kept in the history of each room")
+	replaySize := flag.Int("replay", 10, "Number of messages replayed on join")
+	logFile := flag.String("log", "", "Append messages to this file, and load the history from it on start")
+	flag.Float64Var(&floodRate, "rate", floodRate, "Messages per second allowed for each client")
+	flag.IntVar(&floodBurst, "burst", floodBurst, "Messages allowed at once for each client")
+	flag.IntVar(&floodLimit, "flood-limit", floodLimit, "Messages dropped by -rate before disconnecting the client")
+	slowFlag := flag.String("slow", "drop", "Policy for slow clients: drop, disconnect or buffer=N")
+	banFile := flag.String("bans", "", "File to persist banned names and IP addresses")
+	operFile := flag.String("operators", "", `Operators file, e.g. {"operators": {"alice": "password"}}`)
+	operPassword := flag.String("oper-password", "", "Password of /oper for anyone")
+	httpAddr := flag.String("http", "localhost:8080", "Address of the web page and WebSocket clients, empty to disable")
+	ircAddr := flag.String("irc", "localhost:6667", "Address of IRC clients, empty to disable")
+	name := flag.String("name", "", "Name of this server in the network (default -addr)")
+	links := flag.String("link", "", "Comma separated addresses of peer servers to link to")
+	linkAddr := flag.String("link-listen", "", "Address to accept links from peer servers")
+	linkPassword := flag.String("link-password", "", "Password shared by the linked servers")
+	bots := flag.String("bots", "", "Comma separated bots to run: echo, calc and title")
+	tlsAddr := flag.String("tls", "", "Address of plain text clients over TLS, empty to disable")
+	certFile := flag.String("cert", "", "Certificate file of -tls, self-signed if empty")
+	keyFile := flag.String("key", "", "Key file of -tls")
+	accountFile := flag.String("accounts", "", "File to persist registered names and hashed passwords")
+	flag.DurationVar(&graceTime, "grace", graceTime, "Time to /identify before a registered name is taken away")
+	adminAddr := flag.String("admin", "", "Address of the admin HTTP endpoints /stats and /shutdown, empty to disable")
+	adminToken := flag.String("admin-token", "", "Bearer token of the admin endpoints, required by -admin")
+	flag.Parse()
+
+	var err error
+	if slow, err = parseSlowPolicy(*slowFlag); err != nil {
+		log.Fatal(err)
+	}
+	h := newHub(*historySize, *replaySize)
+	h.operPassword = *operPassword
+	if *operFile != "" {
+		if h.operators, err = loadOperators(*operFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if h.bans, err = loadBans(*banFile); err != nil {
 		log.Fatal(err)
 	}
+	if h.accounts, err = loadAccounts(*accountFile); err != nil {
+		log.Fatal(err)
+	}
+	if *logFile != "" {
+		if err := h.openLog(*logFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *links != "" || *linkAddr != "" {
+		if *name == "" {
+			*name = *addr
+		}
+		h.network = newNetwork(*name, *linkPassword)
+	}
+	if *bots != "" {
+		if err := h.startBots(*bots); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// listen listens on addr, and closes the listener on shutdown.
+	var listeners []net.Listener
+	listen := func(addr string) net.Listener {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listeners = append(listeners, ln)
+		return ln
+	}
+	ln := listen(*addr)
+	shutdown := make(chan string, 1)
 
-	go broadcaster()
-	for {
-		conn, err := listener.Accept()
+	go broadcaster(h)
+	go serve(banListener{ln, h.bans}, handleConn)
+	if *httpAddr != "" {
+		ln := listen(*httpAddr)
+		go func() {
+			if err := serveWeb(banListener{ln, h.bans}); !errors.Is(err, net.ErrClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if *ircAddr != "" {
+		go serveIRC(banListener{listen(*ircAddr), h.bans})
+	}
+	if *tlsAddr != "" {
+		config, err := tlsConfig(*certFile, *keyFile)
 		if err != nil {
-			log.Print(err)
-			continue
+			log.Fatal(err)
+		}
+		go serve(tls.NewListener(banListener{listen(*tlsAddr), h.bans}, config), handleConn)
+	}
+	if *linkAddr != "" {
+		ln := listen(*linkAddr)
+		if err := checkLinkAddr(ln.Addr(), *linkPassword); err != nil {
+			log.Fatal(err)
+		}
+		go h.network.listen(ln)
+	}
+	if *links != "" {
+		for _, peer := range strings.Split(*links, ",") {
+			go h.network.dial(strings.TrimSpace(peer))
+		}
+	}
+	if *adminAddr != "" {
+		if *adminToken == "" {
+			log.Fatal("-admin needs -admin-token")
 		}
-		go handleConn(conn)
+		ln := listen(*adminAddr)
+		go func() {
+			if err := http.Serve(ln, adminHandler(h, *adminToken, shutdown)); !errors.Is(err, net.ErrClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	var reason string
+	select {
+	case sig := <-signals:
+		reason = sig.String()
+	case reason = <-shutdown:
 	}
+	log.Printf("shutting down by %s", reason)
+	closeAll(h, listeners)
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	var tests = []struct {
+		line   string
+		name   string
+		arg    string
+		expect bool
+	}{
+		{"/join #go", "join", "#go", true},
+		{"/WHO", "who", "", true},
+		{"/leave  #go ", "leave", "#go", true},
+		{"hello", "", "", false},
+		{"//not a command", "", "", false},
+	}
+	for _, test := range tests {
+		cmd, ok := parseCommand(nil, test.line)
+		if ok != test.expect || cmd.name != test.name || cmd.arg != test.arg {
+			t.Errorf("parseCommand(%q) = %q, %q, %v, Expected %q, %q, %v",
+				test.line, cmd.name, cmd.arg, ok, test.name, test.arg, test.expect)
+		}
+	}
+}
+
+// newTestClient returns a client and the channel of its outgoing messages.
+func newTestClient(h *hub, name string) (*client, chan string) {
+	out := make(chan string, 100)
+	cli := &client{Out: out, Name: name}
+	h.enter(cli)
+	h.join(cli, lobby)
+	return cli, out
+}
+
+// received returns the messages sent to out so far.
+func received(out chan string) []string {
+	var msgs []string
+	for {
+		select {
+		case msg := <-out:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestRooms(t *testing.T) {
+	h := newHub(10, 0)
+	alice, aliceOut := newTestClient(h, "alice")
+	bob, bobOut := newTestClient(h, "bob")
+	received(aliceOut)
+	received(bobOut)
+
+	h.command(command{from: alice, name: "join", arg: "#Go"})
+	h.say(alice, "", "hi")
+	h.say(bob, "", "hello")
+	// alice is still a member of #lobby.
+	expect := []string{"Joined #go\nPresent:\nalice", "#go alice: hi", "#lobby bob: hello"}
+	if got := received(aliceOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	expect = []string{"#lobby bob: hello"}
+	if got := received(bobOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	h.command(command{from: bob, name: "join", arg: "#go"})
+	h.command(command{from: alice, name: "rooms"})
+	h.command(command{from: alice, name: "leave"})
+	expect = []string{"#go bob has arrived", "Rooms:\n#go (2)\n#lobby (2)", "Left #go, now talking in #lobby"}
+	if got := received(aliceOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	if got := received(bobOut); !strings.HasSuffix(got[len(got)-1], "#go alice has left") {
+		t.Errorf("Result = %q, Expected alice has left", got)
+	}
+
+	h.command(command{from: bob, name: "who", arg: "#lobby"})
+	if got := received(bobOut); !reflect.DeepEqual(got, []string{"Present:\nalice\nbob"}) {
+		t.Errorf("Result = %q, Expected the members of #lobby", got)
+	}
+	h.command(command{from: bob, name: "join", arg: "go"})
+	if got := received(bobOut); !reflect.DeepEqual(got, []string{"Usage: /join #room"}) {
+		t.Errorf("Result = %q, Expected usage", got)
+	}
+}
+
+func TestNicks(t *testing.T) {
+	h := newHub(10, 0)
+	alice, aliceOut := newTestClient(h, "alice")
+	bob, bobOut := newTestClient(h, "bob")
+	if h.enter(&client{Name: "Bob"}) == "" {
+		t.Errorf("Result = true, Expected Bob to be refused")
+	}
+	if h.enter(&client{Name: "#bob"}) == "" {
+		t.Errorf("Result = true, Expected #bob to be refused")
+	}
+	received(aliceOut)
+	received(bobOut)
+
+	h.command(command{from: bob, name: "nick", arg: "ALICE"})
+	h.command(command{from: bob, name: "nick", arg: "robert"})
+	h.command(command{from: bob, name: "away", arg: "lunch"})
+	expect := []string{"Name ALICE is already used", "#lobby bob is now known as robert", "You are marked as away: lunch"}
+	if got := received(bobOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	h.command(command{from: alice, name: "msg", arg: "Robert how are you?"})
+	h.command(command{from: alice, name: "who"})
+	h.command(command{from: alice, name: "msg", arg: "bob hi"})
+	expect = []string{
+		"#lobby bob is now known as robert",
+		"-> *robert* how are you?\nrobert is away: lunch",
+		"Present:\nalice\nrobert (away: lunch)",
+		"No such user bob",
+	}
+	if got := received(aliceOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	if got := received(bobOut); !reflect.DeepEqual(got, []string{"*alice* how are you?"}) {
+		t.Errorf("Result = %q, Expected the private message", got)
+	}
+
+	h.command(command{from: bob, name: "back"})
+	h.leave(bob)
+	if h.enter(&client{Name: "robert"}) != "" {
+		t.Errorf("Result = false, Expected robert to be free after leaving")
+	}
+}
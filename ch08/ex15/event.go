@@ -0,0 +1,124 @@
+package main
+
+// event is something said or done in a room. Plain clients receive it as
+// a line of text, and IRC clients as an IRC message.
+type event struct {
+	kind   string  // say, msg, join, part, quit, nick, topic, kick or ban
+	from   *client // client who caused the event
+	name   string  // name of from at the event, the old name for nick
+	room   string  // "" for msg and quit
+	text   string  // message, new name, topic, quit or kick reason
+	target string  // receiver of msg, kicked client of kick and ban
+}
+
+// describe returns the event in plain text without the room.
+func (ev event) describe() string {
+	switch ev.kind {
+	case "say":
+		return ev.name + ": " + ev.text
+	case "msg":
+		return "*" + ev.name + "* " + ev.text
+	case "join":
+		return ev.name + " has arrived"
+	case "part":
+		return ev.name + " has left"
+	case "quit":
+		if ev.text != "" {
+			return ev.name + " has left (" + ev.text + ")"
+		}
+		return ev.name + " has left"
+	case "nick":
+		return ev.name + " is now known as " + ev.text
+	case "topic":
+		return ev.name + " changed the topic to: " + ev.text
+	case "kick":
+		msg := ev.target + " was kicked by " + ev.name
+		if ev.text != "" {
+			msg += ": " + ev.text
+		}
+		return msg
+	case "ban":
+		return ev.target + " was banned by " + ev.name
+	}
+	return ev.name + " " + ev.kind
+}
+
+// plain returns the event for plain clients, e.g. "#go alice: hello".
+func (ev event) plain() string {
+	if ev.room == "" {
+		return ev.describe()
+	}
+	return ev.room + " " + ev.describe()
+}
+
+// irc returns the event as an IRC message, e.g.
+//  :alice!alice@127.0.0.1 PRIVMSG #go :hello
+func (ev event) irc() string {
+	prefix := ":" + ev.name + "!" + ev.from.userName(ev.name) + "@" + ev.from.host()
+	ev.text = ircText.Replace(ev.text)
+	switch ev.kind {
+	case "say":
+		return prefix + " PRIVMSG " + ev.room + " :" + ev.text
+	case "msg":
+		return prefix + " PRIVMSG " + ev.target + " :" + ev.text
+	case "join":
+		return prefix + " JOIN " + ev.room
+	case "part":
+		return prefix + " PART " + ev.room
+	case "quit":
+		if ev.text != "" {
+			return prefix + " QUIT :" + ev.text
+		}
+		return prefix + " QUIT :Quit"
+	case "nick":
+		return prefix + " NICK " + ev.text
+	case "topic":
+		return prefix + " TOPIC " + ev.room + " :" + ev.text
+	case "kick":
+		return prefix + " KICK " + ev.room + " " + ev.target + " :" + ev.text
+	case "ban":
+		return prefix + " KICK " + ev.room + " " + ev.target + " :Banned"
+	}
+	return ":" + serverName + " NOTICE * :" + ev.plain()
+}
+
+// deliver sends ev to cli in the protocol of cli. IRC clients don't
+// receive their own messages back.
+func deliver(cli *client, ev event) {
+	if !cli.irc {
+		send(cli, ev.plain())
+		return
+	}
+	if (ev.kind == "say" || ev.kind == "msg") && ev.from == cli {
+		return
+	}
+	sendRaw(cli, ev.irc())
+}
+
+// broadcast delivers ev to all members of the room of ev, forwards it to
+// the linked servers and notifies the plugins.
+func (h *hub) broadcast(ev event) {
+	h.forward(ev)
+	for cli := range h.rooms[ev.room] {
+		deliver(cli, ev)
+	}
+	h.notify(ev)
+}
+
+// announce delivers ev to the members of the rooms of cli. Plain clients
+// receive it for each room, and IRC clients receive it once.
+func (h *hub) announce(cli *client, ev event) {
+	h.forward(ev)
+	seen := map[*client]bool{}
+	for _, room := range sortedKeys(cli.rooms) {
+		ev.room = room
+		for c := range h.rooms[room] {
+			if c.irc && seen[c] {
+				continue
+			}
+			seen[c] = true
+			deliver(c, ev)
+		}
+		h.notify(ev)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Flood control of clientReader. They are set by flags.
+var (
+	floodRate  = 2.0 // messages per second
+	floodBurst = 10  // messages sent at once
+	floodLimit = 20  // dropped messages before disconnecting
+)
+
+// bucket is a token bucket which allows burst messages at once and rate
+// messages per second on average.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// refill adds the tokens accumulated since the last call.
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// allow takes a token if any.
+func (b *bucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket has been refilled up to burst, that is
+// the client has calmed down.
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// slowPolicy is how send treats a client whose Out channel is full.
+type slowPolicy struct {
+	disconnect bool // disconnect instead of dropping messages
+	buffer     int  // capacity of Out channels
+}
+
+// slow is set by the -slow flag.
+var slow = slowPolicy{buffer: 10}
+
+// parseSlowPolicy parses "drop", "disconnect" or "buffer=N".
+//  drop: drop messages with a notice if 10 messages are pending.
+//  disconnect: disconnect the client if 10 messages are pending.
+//  buffer=N: keep up to N pending messages, and disconnect the client
+//            if it falls further behind.
+func parseSlowPolicy(s string) (slowPolicy, error) {
+	f := strings.Fields(strings.Replace(s, "=", " ", 1))
+	switch {
+	case len(f) == 1 && f[0] == "drop":
+		return slowPolicy{buffer: 10}, nil
+	case len(f) == 1 && f[0] == "disconnect":
+		return slowPolicy{disconnect: true, buffer: 10}, nil
+	case len(f) == 2 && f[0] == "buffer":
+		n, err := strconv.Atoi(f[1])
+		if err != nil || n <= 0 {
+			return slowPolicy{}, fmt.Errorf("invalid buffer size %q", f[1])
+		}
+		return slowPolicy{disconnect: true, buffer: n}, nil
+	}
+	return slowPolicy{}, fmt.Errorf("unknown policy %q, use drop, disconnect or buffer=N", s)
+}
+
+// send sends the notice msg to cli without blocking. IRC clients receive
+// it as NOTICE messages.
+func send(cli *client, msg string) {
+	if cli.irc {
+		msg = notice(cli, msg)
+	}
+	sendRaw(cli, msg)
+}
+
+// sendRaw sends msg to cli without blocking. If Out of cli is full, msg is
+// dropped or cli is disconnected by the slow policy. The number of dropped
+// messages is notified as soon as Out has room. Nothing is sent to clients
+// without Out: remote clients receive messages from their own servers, bots
+// are notified as plugins, and clients which have left are gone.
+func sendRaw(cli *client, msg string) {
+	if cli.kicked || cli.Out == nil {
+		return
+	}
+	if cli.dropped > 0 {
+		warning := fmt.Sprintf("*** %d messages were dropped because you were reading slowly", cli.dropped)
+		if cli.irc {
+			warning = notice(cli, warning)
+		}
+		select {
+		case cli.Out <- warning:
+			cli.dropped = 0
+		default:
+		}
+	}
+	if cli.dropped == 0 {
+		select {
+		case cli.Out <- msg:
+			return
+		default:
+		}
+	}
+	if !slow.disconnect {
+		cli.dropped++
+		atomic.AddInt64(&droppedTotal, 1)
+		return
+	}
+	// The client reader ends with the closed connection, and then the
+	// client leaves.
+	cli.kicked = true
+	atomic.AddInt64(&slowKicked, 1)
+	if cli.conn != nil {
+		cli.conn.Close()
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(2, 3)
+	b.last = now
+	var got []bool
+	for i := 0; i < 4; i++ {
+		got = append(got, b.allow(now))
+	}
+	// A token is refilled in 500ms.
+	got = append(got, b.allow(now.Add(500*time.Millisecond)), b.allow(now.Add(500*time.Millisecond)))
+	expect := []bool{true, true, true, false, true, false}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %v, Expected %v", got, expect)
+	}
+	if b.full(now.Add(time.Second)) || !b.full(now.Add(2*time.Second)) {
+		t.Errorf("Result = %v, Expected full after 1.5 seconds", b.tokens)
+	}
+}
+
+func TestParseSlowPolicy(t *testing.T) {
+	var tests = []struct {
+		s      string
+		expect slowPolicy
+		ok     bool
+	}{
+		{"drop", slowPolicy{buffer: 10}, true},
+		{"disconnect", slowPolicy{disconnect: true, buffer: 10}, true},
+		{"buffer=100", slowPolicy{disconnect: true, buffer: 100}, true},
+		{"buffer=0", slowPolicy{}, false},
+		{"block", slowPolicy{}, false},
+	}
+	for _, test := range tests {
+		p, err := parseSlowPolicy(test.s)
+		if p != test.expect || (err == nil) != test.ok {
+			t.Errorf("parseSlowPolicy(%q) = %v, %v, Expected %v", test.s, p, err, test.expect)
+		}
+	}
+}
+
+func TestSendSlowClient(t *testing.T) {
+	defer func(p slowPolicy) { slow = p }(slow)
+
+	slow = slowPolicy{buffer: 2}
+	out := make(chan string, 2)
+	cli := &client{Out: out}
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		send(cli, msg)
+	}
+	<-out
+	<-out
+	send(cli, "5")
+	send(cli, "6")
+	expect := []string{"*** 2 messages were dropped because you were reading slowly", "5"}
+	if got := received(out); !reflect.DeepEqual(got, expect) || cli.dropped != 1 {
+		t.Errorf("Result = %q, %d dropped, Expected %q, 1 dropped", got, cli.dropped, expect)
+	}
+
+	slow = slowPolicy{disconnect: true, buffer: 1}
+	server, peer := net.Pipe()
+	defer peer.Close()
+	cli = &client{Out: make(chan string, 1), conn: server}
+	send(cli, "1")
+	send(cli, "2")
+	if !cli.kicked {
+		t.Errorf("Result = false, Expected the slow client to be kicked")
+	}
+	if _, err := server.Write([]byte("x")); err == nil {
+		t.Errorf("Result = nil, Expected the connection to be closed")
+	}
+}
+
+func TestClientReaderFlood(t *testing.T) {
+	defer func(rate float64, burst, limit int) {
+		floodRate, floodBurst, floodLimit = rate, burst, limit
+	}(floodRate, floodBurst, floodLimit)
+	floodRate, floodBurst, floodLimit = 0.001, 2, 2
+
+	server, peer := net.Pipe()
+	defer peer.Close()
+	ch, warn := make(chan string), make(chan string)
+	go clientReader(server, ch, warn)
+	go peer.Write([]byte(strings.Repeat("spam\n", 10)))
+
+	var got, warnings []string
+Loop:
+	for {
+		select {
+		case line, ok := <-ch:
+			if !ok {
+				break Loop
+			}
+			got = append(got, line)
+		case w := <-warn:
+			warnings = append(warnings, w)
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"spam", "spam"}) {
+		t.Errorf("Result = %q, Expected 2 lines within the burst", got)
+	}
+	expect := []string{
+		"*** You are sending too fast. Messages are dropped until you slow down.",
+		"*** Disconnected for flooding",
+	}
+	if !reflect.DeepEqual(warnings, expect) {
+		t.Errorf("Result = %q, Expected %q", warnings, expect)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// record is a message said in a room.
+type record struct {
+	Time time.Time `json:"time"`
+	Room string    `json:"room"`
+	From string    `json:"from"`
+	Text string    `json:"text"`
+}
+
+func (r record) String() string {
+	return fmt.Sprintf("[%s] %s: %s", r.Time.Format("15:04:05"), r.From, r.Text)
+}
+
+// ring keeps the last records up to its capacity.
+type ring struct {
+	recs []record
+	next int // index to write the next record
+	full bool
+}
+
+func newRing(size int) *ring {
+	return &ring{recs: make([]record, size)}
+}
+
+func (r *ring) add(rec record) {
+	if len(r.recs) == 0 {
+		return
+	}
+	r.recs[r.next] = rec
+	r.next = (r.next + 1) % len(r.recs)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last returns the last n records in chronological order.
+func (r *ring) last(n int) []record {
+	size := r.next
+	if r.full {
+		size = len(r.recs)
+	}
+	if n > size {
+		n = size
+	}
+	recs := make([]record, 0, n)
+	for i := r.next - n; i < r.next; i++ {
+		recs = append(recs, r.recs[(i+len(r.recs))%len(r.recs)])
+	}
+	return recs
+}
+
+// record adds the message to the history of the room and the log file.
+func (h *hub) record(rec record) {
+	if h.history[rec.Room] == nil {
+		h.history[rec.Room] = newRing(h.historySize)
+	}
+	h.history[rec.Room].add(rec)
+	if h.log == nil {
+		return
+	}
+	b, _ := json.Marshal(rec)
+	if _, err := h.log.Write(append(b, '\n')); err != nil {
+		log.Print(err)
+	}
+}
+
+// replay sends the last n messages of the room to cli.
+func (h *hub) replay(cli *client, room string, n int) {
+	r := h.history[room]
+	if r == nil || n <= 0 {
+		return
+	}
+	recs := r.last(n)
+	if len(recs) == 0 {
+		return
+	}
+	lines := []string{"History of " + room + ":"}
+	for _, rec := range recs {
+		lines = append(lines, rec.String())
+	}
+	send(cli, strings.Join(lines, "\n"))
+}
+
+// loadHistory reads the log file written by record into the history.
+func (h *hub) loadHistory(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var rec record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil || !validRoom(rec.Room) {
+			log.Printf("history: skip broken line %q", s.Text())
+			continue
+		}
+		if h.history[rec.Room] == nil {
+			h.history[rec.Room] = newRing(h.historySize)
+		}
+		h.history[rec.Room].add(rec)
+	}
+	return s.Err()
+}
+
+// openLog loads the history from the log file and opens it for appending.
+func (h *hub) openLog(filename string) error {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err = h.loadHistory(f); err != nil {
+		f.Close()
+		return err
+	}
+	h.log = f
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	var tests = []struct {
+		size   int
+		add    int
+		n      int
+		expect []string
+	}{
+		{3, 2, 10, []string{"0", "1"}},
+		{3, 3, 10, []string{"0", "1", "2"}},
+		{3, 5, 10, []string{"2", "3", "4"}},
+		{3, 5, 2, []string{"3", "4"}},
+		{3, 0, 2, []string{}},
+		{0, 2, 2, []string{}},
+	}
+	for _, test := range tests {
+		r := newRing(test.size)
+		for i := 0; i < test.add; i++ {
+			r.add(record{Text: string(rune('0' + i))})
+		}
+		got := []string{}
+		for _, rec := range r.last(test.n) {
+			got = append(got, rec.Text)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("size %d, add %d, last(%d) Result = %q, Expected %q",
+				test.size, test.add, test.n, got, test.expect)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var logFile bytes.Buffer
+	h := newHub(2, 1)
+	h.log = &logFile
+	alice, _ := newTestClient(h, "alice")
+	at := time.Date(2016, 9, 1, 12, 34, 56, 0, time.Local)
+	for _, text := range []string{"one", "two", "three"} {
+		h.record(record{Time: at, Room: lobby, From: alice.Name, Text: text})
+	}
+
+	bob, bobOut := newTestClient(h, "bob")
+	h.command(command{from: bob, name: "history", arg: "5"})
+	got := received(bobOut)
+	expect := []string{
+		"Joined #lobby\nPresent:\nalice\nbob",
+		"History of #lobby:\n[12:34:56] alice: three",
+		"History of #lobby:\n[12:34:56] alice: two\n[12:34:56] alice: three",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	// The log file restores the history.
+	if n := strings.Count(logFile.String(), "\n"); n != 3 {
+		t.Errorf("Result = %d lines, Expected 3", n)
+	}
+	restored := newHub(2, 1)
+	if err := restored.loadHistory(strings.NewReader(logFile.String() + "broken\n")); err != nil {
+		t.Fatal(err)
+	}
+	recs := restored.history[lobby].last(5)
+	if len(recs) != 2 || recs[0].Text != "two" || !recs[1].Time.Equal(at) {
+		t.Errorf("Result = %+v, Expected two and three", recs)
+	}
+}
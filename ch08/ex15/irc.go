@@ -0,0 +1,335 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serverName is the prefix of the messages from the server to IRC clients.
+const serverName = "localhost"
+
+// started is the time the server started.
+var started = time.Now()
+
+// serveIRC serves IRC clients on ln. They share rooms with plain clients.
+func serveIRC(ln net.Listener) {
+	serve(ln, handleIRC)
+}
+
+// parseIRC parses an IRC message such as "PRIVMSG #go :hello, world" into
+// the command in upper case and the parameters. The prefix is ignored.
+func parseIRC(line string) (cmd string, params []string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return "", nil
+		}
+		line = line[i:]
+	}
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return cmd, params
+		}
+		if line[0] == ':' && cmd != "" {
+			return cmd, append(params, line[1:])
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			i = len(line)
+		}
+		if cmd == "" {
+			cmd = strings.ToUpper(line[:i])
+		} else {
+			params = append(params, line[:i])
+		}
+		line = line[i:]
+	}
+}
+
+// ircText replaces the characters which would end or break an IRC message
+// in user text such as messages, topics and away reasons.
+var ircText = strings.NewReplacer("\r", " ", "\n", " ", "\x00", "")
+
+// numeric returns the numeric reply to nick such as
+//  :localhost 401 alice bob :No such nick/channel
+// The last parameter is the trailing text.
+func numeric(nick, code string, params ...string) string {
+	msg := ":" + serverName + " " + code + " " + nick
+	for i, p := range params {
+		p = ircText.Replace(p)
+		if i == len(params)-1 {
+			p = ":" + p
+		}
+		msg += " " + p
+	}
+	return msg
+}
+
+// notice returns msg as NOTICE messages to cli, one for each line.
+func notice(cli *client, msg string) string {
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		lines[i] = ":" + serverName + " NOTICE " + cli.Name + " :" + ircText.Replace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reply sends the numeric reply to IRC clients, and text to plain clients.
+func reply(cli *client, text, code string, params ...string) {
+	if cli.irc {
+		sendRaw(cli, numeric(cli.Name, code, params...))
+		return
+	}
+	send(cli, text)
+}
+
+// userName returns the IRC user name of cli, or name if cli has none.
+func (cli *client) userName(name string) string {
+	if cli == nil || cli.user == "" {
+		return name
+	}
+	return ircText.Replace(cli.user)
+}
+
+// host returns the host part of the IRC prefix of cli.
+func (cli *client) host() string {
+	if cli == nil || cli.ip == "" {
+		return serverName
+	}
+	return cli.ip
+}
+
+// welcome sends the replies to the registration of cli.
+func welcome(cli *client) {
+	nick := cli.Name
+	sendRaw(cli, strings.Join([]string{
+		numeric(nick, "001", "Welcome to the chat "+nick+"!"+cli.userName(nick)+"@"+cli.host()),
+		numeric(nick, "002", "Your host is "+serverName),
+		numeric(nick, "003", "This server was created "+started.Format(time.RFC1123)),
+		numeric(nick, "004", serverName, "gopl-chat", "o", "o"),
+		numeric(nick, "422", "MOTD File is missing"),
+	}, "\n"))
+}
+
+// names sends the members of the room to the IRC client cli.
+func (h *hub) names(cli *client, room string) {
+	var names []string
+	for c := range h.rooms[room] {
+		if c.op {
+			names = append(names, "@"+c.Name)
+		} else {
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+	var lines []string
+	if len(names) > 0 {
+		lines = append(lines, numeric(cli.Name, "353", "=", room, strings.Join(names, " ")))
+	}
+	lines = append(lines, numeric(cli.Name, "366", room, "End of /NAMES list"))
+	sendRaw(cli, strings.Join(lines, "\n"))
+}
+
+func handleIRC(conn net.Conn) {
+	out := make(chan string, slow.buffer) // outgoing IRC messages
+	writers.Add(1)
+	go ircWriter(conn, out)
+	in := make(chan string)   // incoming IRC messages
+	warn := make(chan string) // flood warnings of clientReader
+	go clientReader(conn, in, warn)
+
+	cli := ircRegister(conn, in, warn, out)
+	if cli == nil {
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		close(out)
+		return
+	}
+	// IRC clients are pinged when they are idle, and disconnected if
+	// they don't answer.
+	idle := time.NewTimer(timeout)
+	pinged := false
+
+Loop:
+	for {
+		select {
+		case line, ok := <-in:
+			if !ok {
+				break Loop
+			}
+			idle.Reset(timeout)
+			pinged = false
+			if !ircCommand(cli, line) {
+				break Loop
+			}
+		case w := <-warn:
+			notices <- message{from: cli, text: w}
+		case <-idle.C:
+			if pinged {
+				break Loop
+			}
+			out <- "PING :" + serverName
+			pinged = true
+			idle.Reset(timeout)
+		}
+	}
+
+	// ircWriter sends the rest of the replies such as ERROR, and then
+	// closes conn.
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	leaving <- cli
+}
+
+// ircRegister reads NICK and USER from in, and enters the chat. It returns
+// nil if the connection is closed or the client doesn't register in time.
+func ircRegister(conn net.Conn, in, warn <-chan string, out chan<- string) *client {
+	var nick, user, pass string
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-in:
+			if !ok {
+				return nil
+			}
+			cmd, params := parseIRC(line)
+			switch cmd {
+			case "NICK":
+				if len(params) == 0 {
+					out <- numeric("*", "431", "No nickname given")
+					continue
+				}
+				nick = params[0]
+			case "USER":
+				if len(params) < 4 {
+					out <- numeric("*", "461", "USER", "Not enough parameters")
+					continue
+				}
+				user = params[0]
+			case "PING":
+				out <- pong(params)
+				continue
+			case "QUIT":
+				out <- "ERROR :Closing link"
+				return nil
+			case "PASS":
+				// The password identifies the name after registration.
+				if len(params) > 0 {
+					pass = params[0]
+				}
+				continue
+			case "", "CAP":
+				// Capabilities are not supported.
+				continue
+			default:
+				out <- numeric("*", "451", "You have not registered")
+				continue
+			}
+			if nick == "" || user == "" {
+				continue
+			}
+			cli := &client{Out: out, Name: nick, conn: conn, ip: remoteIP(conn), irc: true, user: user}
+			result := make(chan string)
+			entering <- entry{cli, result}
+			reason := <-result
+			if reason == "" {
+				if pass != "" {
+					commands <- command{from: cli, name: "identify", arg: pass}
+				}
+				return cli
+			}
+			code := "432"
+			if strings.HasSuffix(reason, "already used.") {
+				code = "433"
+			}
+			out <- numeric("*", code, nick, reason)
+			nick = ""
+		case w := <-warn:
+			out <- ":" + serverName + " NOTICE * :" + w
+		case <-timer.C:
+			out <- "ERROR :Registration timed out"
+			return nil
+		}
+	}
+}
+
+// ircCommand sends the IRC message of the registered client cli to
+// broadcaster as a message or commands. It returns false on QUIT.
+func ircCommand(cli *client, line string) bool {
+	cmd, params := parseIRC(line)
+	param := func(i int) string {
+		if i < len(params) {
+			return params[i]
+		}
+		return ""
+	}
+	switch cmd {
+	case "":
+	case "NICK":
+		commands <- command{from: cli, name: "nick", arg: param(0)}
+	case "JOIN", "PART", "NAMES":
+		name := map[string]string{"JOIN": "join", "PART": "leave", "NAMES": "who"}[cmd]
+		for _, room := range strings.Split(param(0), ",") {
+			commands <- command{from: cli, name: name, arg: room}
+		}
+	case "PRIVMSG", "NOTICE":
+		text := param(1)
+		if text == "" {
+			break
+		}
+		for _, to := range strings.Split(param(0), ",") {
+			if strings.HasPrefix(to, "#") {
+				messages <- message{from: cli, room: strings.ToLower(to), text: text}
+			} else {
+				commands <- command{from: cli, name: "msg", arg: to + " " + text}
+			}
+		}
+	case "TOPIC":
+		commands <- command{from: cli, name: "topic", arg: param(1), room: strings.ToLower(param(0))}
+	case "AWAY":
+		if param(0) == "" {
+			commands <- command{from: cli, name: "back"}
+		} else {
+			commands <- command{from: cli, name: "away", arg: param(0)}
+		}
+	case "KICK":
+		// KICK #room name :reason kicks the client out of the chat.
+		commands <- command{from: cli, name: "kick", arg: strings.TrimSpace(param(1) + " " + param(2))}
+	case "PING":
+		cli.Out <- pong(params)
+	case "PONG":
+	case "QUIT":
+		cli.Out <- "ERROR :Closing link"
+		return false
+	default:
+		// Others such as OPER and HELP are the slash commands.
+		commands <- command{from: cli, name: strings.ToLower(cmd), arg: strings.Join(params, " ")}
+	}
+	return true
+}
+
+func pong(params []string) string {
+	token := serverName
+	if len(params) > 0 {
+		token = params[0]
+	}
+	return ":" + serverName + " PONG " + serverName + " :" + token
+}
+
+// ircLine converts the lines of a message to IRC messages. Stray CR and NUL
+// are dropped, so that they can't start another message.
+var ircLine = strings.NewReplacer("\r", "", "\x00", "", "\n", "\r\n")
+
+// ircWriter writes IRC messages terminated by CRLF, and closes conn when
+// ch is closed.
+func ircWriter(conn net.Conn, ch <-chan string) {
+	defer writers.Done()
+	defer conn.Close()
+	for msg := range ch {
+		io.WriteString(conn, ircLine.Replace(msg)+"\r\n") // NOTE: ignoring network errors
+	}
+}
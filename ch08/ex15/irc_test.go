@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseIRC(t *testing.T) {
+	var tests = []struct {
+		line   string
+		cmd    string
+		params []string
+	}{
+		{"NICK alice\r", "NICK", []string{"alice"}},
+		{"USER alice 0 * :Alice Liddell", "USER", []string{"alice", "0", "*", "Alice Liddell"}},
+		{":alice PRIVMSG #go :hello, world", "PRIVMSG", []string{"#go", "hello, world"}},
+		{"privmsg  bob  ::-)", "PRIVMSG", []string{"bob", ":-)"}},
+		{"TOPIC #go :", "TOPIC", []string{"#go", ""}},
+		{"QUIT", "QUIT", nil},
+		{":alice", "", nil},
+		{"", "", nil},
+	}
+	for _, test := range tests {
+		cmd, params := parseIRC(test.line)
+		if cmd != test.cmd || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("parseIRC(%q) = %q, %q, Expected %q, %q", test.line, cmd, params, test.cmd, test.params)
+		}
+	}
+}
+
+func TestIRCEvents(t *testing.T) {
+	h := newHub(10, 0)
+	alice, aliceOut := newTestClient(h, "alice")
+	bobOut := make(chan string, 100)
+	bob := &client{Out: bobOut, Name: "bob", ip: "10.0.0.1", irc: true, user: "robert"}
+	h.enter(bob)
+	h.join(bob, lobby)
+	h.topics[lobby] = "welcome"
+	h.command(command{from: bob, name: "join", arg: "#go"})
+	h.command(command{from: alice, name: "join", arg: "#go"})
+	received(aliceOut)
+
+	h.say(bob, "#lobby", "hi")
+	h.say(alice, "", "hello")
+	h.command(command{from: alice, name: "msg", arg: "bob psst"})
+	h.command(command{from: bob, name: "nick", arg: "rob"})
+	h.command(command{from: bob, name: "msg", arg: "carol hi"})
+	h.command(command{from: bob, name: "topic", room: "#go"})
+	h.quit(alice, "")
+	expect := []string{
+		":bob!robert@10.0.0.1 JOIN #lobby",
+		":localhost 353 bob = #lobby :alice bob\n:localhost 366 bob #lobby :End of /NAMES list",
+		":bob!robert@10.0.0.1 JOIN #go",
+		":localhost 353 bob = #go :bob\n:localhost 366 bob #go :End of /NAMES list",
+		":alice!alice@localhost JOIN #go",
+		":alice!alice@localhost PRIVMSG #go :hello",
+		":alice!alice@localhost PRIVMSG bob :psst",
+		":bob!robert@10.0.0.1 NICK rob",
+		":localhost 401 rob carol :No such nick/channel",
+		":localhost 331 rob #go :No topic is set",
+		":alice!alice@localhost QUIT :Quit",
+	}
+	if got := received(bobOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	expect = []string{"#lobby bob: hi", "#go alice: hello", "-> *bob* psst", "#go bob is now known as rob", "#lobby bob is now known as rob"}
+	if got := received(aliceOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+}
+
+// readLines reads n lines from r, and fails the test on errors.
+func readLines(t *testing.T, r *bufio.Reader, n int) []string {
+	var lines []string
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Result = %q, %v, Expected %d lines", lines, err, n)
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	return lines
+}
+
+// broadcasting starts broadcaster shared by the tests of handlers.
+var broadcasting sync.Once
+
+func TestIRC(t *testing.T) {
+	broadcasting.Do(func() { go broadcaster(newHub(10, 0)) })
+
+	ircConn, ircPeer := net.Pipe()
+	defer ircPeer.Close()
+	go handleIRC(ircConn)
+	plainConn, plainPeer := net.Pipe()
+	defer plainPeer.Close()
+	go handleConn(plainConn)
+	ircPeer.SetDeadline(time.Now().Add(5 * time.Second))
+	plainPeer.SetDeadline(time.Now().Add(5 * time.Second))
+	irc, plain := bufio.NewReader(ircPeer), bufio.NewReader(plainPeer)
+	write := func(w io.Writer, s string) {
+		if _, err := io.WriteString(w, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(ircPeer, "CAP LS 302\r\nNICK alice\r\nUSER alice 0 * :Alice\r\n")
+	got := readLines(t, irc, 8)
+	if !strings.HasPrefix(got[0], ":localhost 001 alice ") || got[5] != ":alice!alice@pipe JOIN #lobby" ||
+		got[6] != ":localhost 353 alice = #lobby :alice" {
+		t.Errorf("Result = %q, Expected the welcome and JOIN #lobby", got)
+	}
+
+	readLines(t, plain, 1)
+	write(plainPeer, "bob\n")
+	readLines(t, plain, 5)
+	if got := readLines(t, irc, 1); got[0] != ":bob!bob@pipe JOIN #lobby" {
+		t.Errorf("Result = %q, Expected bob to join", got)
+	}
+
+	write(ircPeer, "PRIVMSG #lobby :hi bob\r\n")
+	if got := readLines(t, plain, 1); got[0] != "#lobby alice: hi bob" {
+		t.Errorf("Result = %q, Expected the message of alice", got)
+	}
+	write(plainPeer, "hello alice\n")
+	readLines(t, plain, 1)
+	write(ircPeer, "PING :abc\r\nNAMES #lobby\r\nNICK BOB\r\n")
+	expect := []string{
+		":bob!bob@pipe PRIVMSG #lobby :hello alice",
+		":localhost PONG localhost :abc",
+		":localhost 353 alice = #lobby :alice bob",
+		":localhost 366 alice #lobby :End of /NAMES list",
+		":localhost 433 alice BOB :Nickname is already in use",
+	}
+	if got := readLines(t, irc, len(expect)); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	plainPeer.Close()
+	if got := readLines(t, irc, 1); got[0] != ":bob!bob@pipe QUIT :Quit" {
+		t.Errorf("Result = %q, Expected bob to quit", got)
+	}
+	write(ircPeer, "QUIT\r\n")
+	if got := readLines(t, irc, 1); got[0] != "ERROR :Closing link" {
+		t.Errorf("Result = %q, Expected ERROR", got)
+	}
+	// The connection is closed after alice leaves.
+	if _, err := irc.ReadString('\n'); err != io.EOF {
+		t.Errorf("Result = %v, Expected EOF", err)
+	}
+}
+
+func TestIRCFlood(t *testing.T) {
+	defer func(rate float64, burst, limit int) {
+		floodRate, floodBurst, floodLimit = rate, burst, limit
+	}(floodRate, floodBurst, floodLimit)
+	floodRate, floodBurst, floodLimit = 0.001, 3, 2
+	broadcasting.Do(func() { go broadcaster(newHub(10, 0)) })
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go handleIRC(conn)
+	peer.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(peer)
+	io.WriteString(peer, "NICK flooder\r\nUSER flooder 0 * :F\r\n")
+	readLines(t, r, 8)
+
+	go io.WriteString(peer, strings.Repeat("PRIVMSG #lobby :spam\r\n", 5))
+	expect := []string{
+		":localhost NOTICE flooder :*** You are sending too fast. Messages are dropped until you slow down.",
+		":localhost NOTICE flooder :*** Disconnected for flooding",
+	}
+	if got := readLines(t, r, len(expect)); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	if _, err := r.ReadString('\n'); err != io.EOF {
+		t.Errorf("Result = %v, Expected EOF", err)
+	}
+}
+
+func TestIRCInjection(t *testing.T) {
+	h := newHub(10, 0)
+	alice, aliceOut := newTestClient(h, "alice")
+	bobOut := make(chan string, 100)
+	bob := &client{Out: bobOut, Name: "bob", irc: true, user: "rob\rert"}
+	h.enter(bob)
+	h.join(bob, lobby)
+	received(aliceOut)
+	received(bobOut)
+
+	h.say(alice, "", "hi\r:op!x@y PRIVMSG #lobby :forged\nagain\x00")
+	h.command(command{from: alice, name: "away", arg: "out\r\n:x 001"})
+	h.command(command{from: bob, name: "msg", arg: "alice psst"})
+	h.command(command{from: bob, name: "nick", arg: "op!x@y"})
+	h.command(command{from: bob, name: "join", arg: "#go\rPRIVMSG"})
+	expect := []string{
+		":alice!alice@localhost PRIVMSG #lobby :hi :op!x@y PRIVMSG #lobby :forged again",
+		":localhost 301 bob alice :out  :x 001",
+		":localhost 432 bob op!x@y :Erroneous nickname",
+		":localhost NOTICE bob :Usage: /join #room",
+	}
+	if got := received(bobOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	// Each message is written as a line.
+	var tests = []struct {
+		msg    string
+		expect string
+	}{
+		{"a\rb", "ab\r\n"},
+		{"a\nb", "a\r\nb\r\n"},
+		{"a\r\nb\x00", "a\r\nb\r\n"},
+	}
+	for _, test := range tests {
+		if got := ircLine.Replace(test.msg) + "\r\n"; got != test.expect {
+			t.Errorf("Result = %q, Expected %q", got, test.expect)
+		}
+	}
+	if validNick("a\rb") || validNick("x@y") || validRoom("#a\rb") {
+		t.Errorf("Result = true, Expected names with CR, ! or @ to be invalid")
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Timing of links. They are variables for tests.
+var (
+	linkInterval = time.Second      // interval of heartbeats
+	linkTimeout  = 5 * time.Second  // silence of a server before a netsplit
+	linkRetry    = 3 * time.Second  // interval of reconnecting to a peer
+	linkBuffer   = 1000             // messages queued to a peer before dropping the link
+	seenSize     = 10000            // message IDs remembered against loops
+	linkHello    = 10 * time.Second // timeout of hello
+)
+
+// linkMsg is a message between servers, sent as a JSON line. Messages are
+// flooded to all servers, and dropped by the ID if they come back.
+type linkMsg struct {
+	ID       string `json:"id,omitempty"`
+	Origin   string `json:"origin"` // server of the user, or the sender of ping and hello
+	Kind     string `json:"kind"`   // hello, auth, ping, user, join, part, say, quit, nick, topic or msg
+	Name     string `json:"name,omitempty"`
+	Room     string `json:"room,omitempty"`
+	Text     string `json:"text,omitempty"`      // message, reason, new name, topic, nonce of hello or HMAC of auth
+	To       string `json:"to,omitempty"`        // receiver of msg
+	ToServer string `json:"to_server,omitempty"` // server of the receiver of msg
+}
+
+// link is a connection to a peer server.
+type link struct {
+	conn net.Conn
+	peer string      // name of the peer server
+	out  chan []byte // JSON lines to the peer
+}
+
+// linkEvent is a link going up or down, or a message received on it.
+type linkEvent struct {
+	l    *link
+	up   bool // l is established
+	down bool // l is lost
+	m    linkMsg
+}
+
+// network is the state of the links of a server. Only in and the fields
+// set by newNetwork can be used outside of broadcaster.
+type network struct {
+	name     string // name of this server, unique in the network
+	password string // key of the HMAC of auth
+	in       chan linkEvent
+
+	seq     int
+	links   map[*link]bool
+	seen    map[string]bool      // recent message IDs
+	order   []string             // seen in the order of arrival
+	servers map[string]time.Time // last heartbeat of each server
+	users   map[string]*client   // remote clients by "server/name"
+}
+
+func newNetwork(name, password string) *network {
+	return &network{
+		name:     name,
+		password: password,
+		in:       make(chan linkEvent),
+		links:    map[*link]bool{},
+		seen:     map[string]bool{},
+		servers:  map[string]time.Time{},
+		users:    map[string]*client{},
+	}
+}
+
+// checkLinkAddr refuses to accept links without password on addresses
+// other than loopback, where anyone could link and speak as any user.
+func checkLinkAddr(addr net.Addr, password string) error {
+	if password != "" {
+		return nil
+	}
+	if a, ok := addr.(*net.TCPAddr); ok && a.IP.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("link: %v is not a loopback address, set -link-password", addr)
+}
+
+// listen accepts links from peers on ln.
+func (n *network) listen(ln net.Listener) {
+	serve(ln, func(conn net.Conn) { n.serve(conn, true) })
+}
+
+// dial links to the peer at addr, and reconnects when the link is lost.
+func (n *network) dial(addr string) {
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			log.Print(err)
+		} else {
+			n.serve(conn, false)
+		}
+		time.Sleep(linkRetry)
+	}
+}
+
+// serve authenticates the peer on conn, and then passes the messages of
+// the peer to broadcaster until the link is lost. accepted is true if the
+// peer has connected to this server.
+//
+// The password is never sent. Each side sends a nonce in hello, and proves
+// the password by auth with the HMAC of its name and both nonces. The
+// accepting side sends its auth only after checking the auth of the peer.
+func (n *network) serve(conn net.Conn, accepted bool) {
+	defer conn.Close()
+	input := bufio.NewScanner(conn)
+	input.Buffer(nil, 1<<20)
+	conn.SetReadDeadline(time.Now().Add(linkHello))
+	nonce := newNonce()
+	if !writeLink(conn, linkMsg{Origin: n.name, Kind: "hello", Text: nonce}) {
+		return
+	}
+	hello, ok := readLink(input, "hello")
+	if !ok {
+		log.Printf("link %s: no hello", conn.RemoteAddr())
+		return
+	}
+	if hello.Origin == "" || hello.Origin == n.name {
+		log.Printf("link %s: invalid server name %q", conn.RemoteAddr(), hello.Origin)
+		return
+	}
+	auth := linkMsg{Origin: n.name, Kind: "auth", Text: n.mac(n.name, hello.Text, nonce)}
+	if !accepted && !writeLink(conn, auth) {
+		return
+	}
+	m, ok := readLink(input, "auth")
+	if !ok || !hmac.Equal([]byte(m.Text), []byte(n.mac(hello.Origin, nonce, hello.Text))) {
+		log.Printf("link %s: wrong password", conn.RemoteAddr())
+		return
+	}
+	if accepted && !writeLink(conn, auth) {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	l := &link{conn: conn, peer: hello.Origin, out: make(chan []byte, linkBuffer)}
+	go func() {
+		for data := range l.out {
+			conn.Write(data) // NOTE: ignoring network errors
+		}
+	}()
+	n.in <- linkEvent{l: l, up: true}
+	for input.Scan() {
+		var m linkMsg
+		if err := json.Unmarshal(input.Bytes(), &m); err != nil {
+			log.Printf("link %s: %v", l.peer, err)
+			continue
+		}
+		n.in <- linkEvent{l: l, m: m}
+	}
+	n.in <- linkEvent{l: l, down: true}
+}
+
+// mac returns the proof of the password by the server name for the nonce
+// of the peer and its own nonce.
+func (n *network) mac(name, challenge, nonce string) string {
+	h := hmac.New(sha256.New, []byte(n.password))
+	io.WriteString(h, name+"\n"+challenge+"\n"+nonce)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeLink writes m to conn before the link is established.
+func writeLink(conn net.Conn, m linkMsg) bool {
+	data, _ := json.Marshal(m)
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// readLink reads a message of the kind before the link is established.
+func readLink(input *bufio.Scanner, kind string) (linkMsg, bool) {
+	var m linkMsg
+	ok := input.Scan() && json.Unmarshal(input.Bytes(), &m) == nil && m.Kind == kind
+	return m, ok
+}
+
+// remember records the message ID. It reports whether the ID is new.
+func (n *network) remember(id string) bool {
+	if n.seen[id] {
+		return false
+	}
+	n.seen[id] = true
+	n.order = append(n.order, id)
+	if len(n.order) > seenSize {
+		delete(n.seen, n.order[0])
+		n.order = n.order[1:]
+	}
+	return true
+}
+
+// encode returns m as a JSON line. m gets a new ID if it has none.
+func (n *network) encode(m linkMsg) []byte {
+	if m.ID == "" {
+		n.seq++
+		m.ID = fmt.Sprintf("%s-%x-%d", n.name, started.UnixNano(), n.seq)
+		n.remember(m.ID)
+	}
+	data, _ := json.Marshal(m)
+	return append(data, '\n')
+}
+
+// flood sends m to the links except the one m came from.
+func (n *network) flood(m linkMsg, from *link) {
+	data := n.encode(m)
+	for l := range n.links {
+		if l != from {
+			n.send(l, data)
+		}
+	}
+}
+
+// send queues data to l without blocking. A peer too slow to read is
+// disconnected, and reconnects later.
+func (n *network) send(l *link, data []byte) {
+	select {
+	case l.out <- data:
+	default:
+		log.Printf("link %s: too slow, disconnecting", l.peer)
+		delete(n.links, l)
+		if l.conn != nil {
+			l.conn.Close()
+		}
+	}
+}
+
+// forward sends the event of a local client to the other servers.
+func (h *hub) forward(ev event) {
+	if h.network == nil || ev.from == nil || ev.from.server != "" {
+		return
+	}
+	m := linkMsg{Origin: h.network.name, Kind: ev.kind, Name: ev.name, Room: ev.room, Text: ev.text}
+	switch ev.kind {
+	case "say", "join", "part", "quit", "nick", "topic":
+	case "msg":
+		target := h.nicks[strings.ToLower(ev.target)]
+		if target == nil || target.server == "" {
+			return
+		}
+		m.To, m.ToServer = target.remoteName, target.server
+	default:
+		return
+	}
+	h.network.flood(m, nil)
+}
+
+// handleLink handles the link event received by broadcaster.
+func (h *hub) handleLink(le linkEvent) {
+	n := h.network
+	switch {
+	case le.up:
+		log.Printf("link %s: established", le.l.peer)
+		n.links[le.l] = true
+		h.burst(le.l)
+	case le.down:
+		log.Printf("link %s: lost", le.l.peer)
+		delete(n.links, le.l)
+		close(le.l.out)
+	default:
+		h.receive(le.m, le.l)
+	}
+}
+
+// burst sends the clients and topics known to this server to the new link.
+func (h *hub) burst(l *link) {
+	n := h.network
+	var users []*client
+	for cli := range h.clients {
+		users = append(users, cli)
+	}
+	for _, cli := range n.users {
+		users = append(users, cli)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	for _, cli := range users {
+		origin, name := n.name, cli.Name
+		if cli.server != "" {
+			origin, name = cli.server, cli.remoteName
+		}
+		n.send(l, n.encode(linkMsg{Origin: origin, Kind: "user", Name: name}))
+		for _, room := range sortedKeys(cli.rooms) {
+			n.send(l, n.encode(linkMsg{Origin: origin, Kind: "join", Name: name, Room: room}))
+		}
+	}
+	for _, room := range sortedKeys(h.roomTopics()) {
+		n.send(l, n.encode(linkMsg{Origin: n.name, Kind: "topic", Name: n.name, Room: room, Text: h.topics[room]}))
+	}
+}
+
+// roomTopics returns the set of rooms with topics.
+func (h *hub) roomTopics() map[string]bool {
+	rooms := map[string]bool{}
+	for room, topic := range h.topics {
+		if topic != "" {
+			rooms[room] = true
+		}
+	}
+	return rooms
+}
+
+// receive applies the message from the link l, and forwards it to the
+// other links.
+func (h *hub) receive(m linkMsg, l *link) {
+	n := h.network
+	if m.ID == "" || m.Origin == n.name || !n.remember(m.ID) {
+		return
+	}
+	n.flood(m, l)
+	if m.Kind == "ping" {
+		n.servers[m.Origin] = time.Now()
+		return
+	}
+	if m.Kind == "topic" {
+		if validRoom(m.Room) && h.topics[m.Room] != m.Text {
+			h.topics[m.Room] = m.Text
+			h.broadcast(event{kind: "topic", name: m.Name, room: m.Room, text: m.Text})
+		}
+		return
+	}
+	if !validNick(m.Name) {
+		return
+	}
+	key := m.Origin + "/" + m.Name
+	cli := n.users[key]
+	if cli == nil {
+		if m.Kind == "quit" {
+			return
+		}
+		cli = h.remoteUser(m.Origin, m.Name)
+	}
+	switch m.Kind {
+	case "join":
+		if validRoom(m.Room) && !cli.rooms[m.Room] {
+			h.join(cli, m.Room)
+		}
+	case "part":
+		if cli.rooms[m.Room] {
+			h.part(cli, m.Room)
+		}
+	case "say":
+		if !validRoom(m.Room) {
+			return
+		}
+		if !cli.rooms[m.Room] {
+			h.join(cli, m.Room)
+		}
+		h.say(cli, m.Room, m.Text)
+	case "quit":
+		h.quit(cli, m.Text)
+		h.leave(cli)
+		delete(n.users, key)
+	case "nick":
+		if !validNick(m.Text) {
+			return
+		}
+		delete(n.users, key)
+		n.users[m.Origin+"/"+m.Text] = cli
+		cli.remoteName = m.Text
+		h.rename(cli, h.freeName(m.Text, m.Origin, cli))
+	case "msg":
+		if m.ToServer == n.name {
+			h.msg(cli, m.To, m.Text)
+		}
+	}
+}
+
+// remoteUser registers the client of the server.
+func (h *hub) remoteUser(server, name string) *client {
+	n := h.network
+	cli := &client{Name: h.freeName(name, server, nil), server: server, remoteName: name}
+	h.nicks[strings.ToLower(cli.Name)] = cli
+	n.users[server+"/"+name] = cli
+	if _, ok := n.servers[server]; !ok {
+		n.servers[server] = time.Now()
+	}
+	return cli
+}
+
+// freeName returns name if it is not used by others than cli, otherwise
+// "name|server", with a number if it is used too. Characters of server
+// invalid in nicknames, such as ':' of "localhost:8000", are replaced by '_'.
+func (h *hub) freeName(name, server string, cli *client) string {
+	free := func(name string) bool {
+		other := h.nicks[strings.ToLower(name)]
+		return other == nil || other == cli
+	}
+	if free(name) {
+		return name
+	}
+	base := name + "|" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, server)
+	candidate := base
+	for i := 2; !free(candidate); i++ {
+		candidate = base + strconv.Itoa(i)
+	}
+	return candidate
+}
+
+// heartbeat tells the other servers that this server is alive, and splits
+// the servers which have been silent for linkTimeout.
+func (h *hub) heartbeat(now time.Time) {
+	n := h.network
+	n.flood(linkMsg{Origin: n.name, Kind: "ping"}, nil)
+	for server, last := range n.servers {
+		if now.Sub(last) > linkTimeout {
+			h.split(server)
+		}
+	}
+}
+
+// split removes the clients of the server lost by a netsplit.
+func (h *hub) split(server string) {
+	n := h.network
+	log.Printf("netsplit: %s is lost", server)
+	delete(n.servers, server)
+	for key, cli := range n.users {
+		if cli.server == server {
+			h.quit(cli, "netsplit")
+			h.leave(cli)
+			delete(n.users, key)
+		}
+	}
+}
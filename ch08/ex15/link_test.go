@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// linkHubs links every pair of the hubs, and returns the function which
+// delivers the queued messages between them until they are quiet.
+func linkHubs(hubs ...*hub) (pump func()) {
+	type route struct {
+		to   *hub
+		back *link
+	}
+	routes := map[*link]route{}
+	for i, a := range hubs {
+		for _, b := range hubs[i+1:] {
+			ab := &link{peer: b.network.name, out: make(chan []byte, linkBuffer)}
+			ba := &link{peer: a.network.name, out: make(chan []byte, linkBuffer)}
+			routes[ab] = route{b, ba}
+			routes[ba] = route{a, ab}
+			a.handleLink(linkEvent{l: ab, up: true})
+			b.handleLink(linkEvent{l: ba, up: true})
+		}
+	}
+	return func() {
+		for moved := true; moved; {
+			moved = false
+			for l, r := range routes {
+				select {
+				case data := <-l.out:
+					var m linkMsg
+					json.Unmarshal(data, &m)
+					r.to.handleLink(linkEvent{l: r.back, m: m})
+					moved = true
+				default:
+				}
+			}
+		}
+	}
+}
+
+func newLinkedHub(name string) *hub {
+	h := newHub(10, 0)
+	h.network = newNetwork(name, "")
+	return h
+}
+
+func TestLinks(t *testing.T) {
+	a, b, c := newLinkedHub("a"), newLinkedHub("b"), newLinkedHub("c")
+	alice, aliceOut := newTestClient(a, "alice")
+	_, bobOut := newTestClient(b, "bob")
+	carol, carolOut := newTestClient(c, "carol")
+	// The servers are linked in a triangle, so that every message has two
+	// routes.
+	pump := linkHubs(a, b, c)
+	pump()
+	received(aliceOut)
+	received(bobOut)
+	received(carolOut)
+
+	a.say(alice, "", "hi")
+	pump()
+	c.command(command{from: carol, name: "msg", arg: "alice psst"})
+	c.command(command{from: carol, name: "nick", arg: "caroline"})
+	pump()
+	expect := []string{"#lobby alice: hi", "*carol* psst", "#lobby carol is now known as caroline"}
+	if got := received(aliceOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	expect = []string{"#lobby alice: hi", "#lobby carol is now known as caroline"}
+	if got := received(bobOut); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+	a.command(command{from: alice, name: "who"})
+	if got := received(aliceOut); !reflect.DeepEqual(got, []string{"Present:\nalice\nbob\ncaroline"}) {
+		t.Errorf("Result = %q, Expected the members of all servers", got)
+	}
+
+	// c is silent, and a and b split it.
+	now := time.Now().Add(linkTimeout + time.Second)
+	a.heartbeat(now)
+	if got := received(aliceOut); !reflect.DeepEqual(got, []string{"#lobby caroline has left (netsplit)", "#lobby bob has left (netsplit)"}) &&
+		!reflect.DeepEqual(got, []string{"#lobby bob has left (netsplit)", "#lobby caroline has left (netsplit)"}) {
+		t.Errorf("Result = %q, Expected bob and caroline to be split", got)
+	}
+	if a.nicks["caroline"] != nil || len(a.network.users) != 0 {
+		t.Errorf("Result = %v, Expected no remote users", a.network.users)
+	}
+}
+
+func TestNameCollision(t *testing.T) {
+	a, b := newLinkedHub("a"), newLinkedHub("b")
+	_, aliceOut := newTestClient(a, "bob")
+	newTestClient(b, "bob")
+	pump := linkHubs(a, b)
+	pump()
+	if got := received(aliceOut); !reflect.DeepEqual(got[len(got)-1], "#lobby bob|b has arrived") {
+		t.Errorf("Result = %q, Expected bob of b to be renamed", got)
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	h := newHub(10, 0)
+	bob, _ := newTestClient(h, "bob")
+	newTestClient(h, "bob|b")
+	var tests = []struct {
+		name, server string
+		cli          *client
+		expect       string
+	}{
+		{"alice", "b", nil, "alice"},
+		{"bob", "b", bob, "bob"},
+		{"Bob", "c", nil, "Bob|c"},
+		{"bob", "b", nil, "bob|b2"},
+		{"bob", "localhost:8000", nil, "bob|localhost_8000"},
+		{"bob", "a@b!c", nil, "bob|a_b_c"},
+	}
+	for _, test := range tests {
+		got := h.freeName(test.name, test.server, test.cli)
+		if got != test.expect || !validNick(got) {
+			t.Errorf("freeName(%q, %q) = %q, Expected %q", test.name, test.server, got, test.expect)
+		}
+	}
+}
+
+func TestServeLink(t *testing.T) {
+	var tests = []struct {
+		password1, password2 string
+		expect               bool
+	}{
+		{"", "", true},
+		{"secret", "secret", true},
+		{"secret", "wrong", false},
+		{"secret", "", false},
+	}
+	for _, test := range tests {
+		n1, n2 := newNetwork("a", test.password1), newNetwork("b", test.password2)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p1, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p2, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln.Close()
+		go n1.serve(p1, false)
+		go n2.serve(p2, true)
+		select {
+		case le := <-n1.in:
+			if !test.expect || !le.up || le.l.peer != "b" {
+				t.Errorf("%q, %q: Result = %+v, Expected %v", test.password1, test.password2, le, test.expect)
+			}
+			le.l.conn.Close()
+		case <-time.After(200 * time.Millisecond):
+			if test.expect {
+				t.Errorf("%q, %q: Result = timeout, Expected the link", test.password1, test.password2)
+			}
+		}
+		p1.Close()
+		p2.Close()
+	}
+}
+
+// The accepting side sends only its hello to a peer which can't prove the
+// password.
+func TestLinkPassword(t *testing.T) {
+	n := newNetwork("a", "secret")
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go n.serve(server, true)
+
+	input := bufio.NewScanner(conn)
+	var hello linkMsg
+	if !input.Scan() || json.Unmarshal(input.Bytes(), &hello) != nil || hello.Kind != "hello" {
+		t.Fatalf("Result = %q, Expected hello", input.Text())
+	}
+	if strings.Contains(input.Text(), "secret") {
+		t.Errorf("Result = %q, Expected no password", input.Text())
+	}
+	go func() {
+		writeLink(conn, linkMsg{Origin: "mallory", Kind: "hello", Text: hello.Text})
+		// a proof made by a, not by mallory
+		writeLink(conn, linkMsg{Origin: "mallory", Kind: "auth", Text: n.mac("a", hello.Text, hello.Text)})
+	}()
+	if input.Scan() {
+		t.Errorf("Result = %q, Expected the link to be closed", input.Text())
+	}
+}
+
+func TestCheckLinkAddr(t *testing.T) {
+	var tests = []struct {
+		ip       string
+		password string
+		err      bool
+	}{
+		{"127.0.0.1", "", false},
+		{"::1", "", false},
+		{"0.0.0.0", "", true},
+		{"192.0.2.1", "", true},
+		{"::", "", true},
+		{"0.0.0.0", "secret", false},
+	}
+	for _, test := range tests {
+		addr := &net.TCPAddr{IP: net.ParseIP(test.ip), Port: 7000}
+		if err := checkLinkAddr(addr, test.password); (err != nil) != test.err {
+			t.Errorf("checkLinkAddr(%v, %q) = %v, Expected error %v", addr, test.password, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// banList is the set of banned nicknames and IP addresses. It is shared by
+// broadcaster and the accept loops, and saved to the file on each change.
+type banList struct {
+	mu       sync.Mutex
+	filename string // "" if not persisted
+	nicks    map[string]bool
+	ips      map[string]bool
+}
+
+// banFile is the JSON format of the ban list file.
+type banFile struct {
+	Nicks []string `json:"nicks"`
+	IPs   []string `json:"ips"`
+}
+
+// loadBans reads the ban list from filename. A missing file is an empty list.
+func loadBans(filename string) (*banList, error) {
+	b := &banList{filename: filename, nicks: map[string]bool{}, ips: map[string]bool{}}
+	if filename == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f banFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, n := range f.Nicks {
+		b.nicks[strings.ToLower(n)] = true
+	}
+	for _, ip := range f.IPs {
+		b.ips[ip] = true
+	}
+	return b, nil
+}
+
+// save writes the list to the file. b.mu must be held.
+func (b *banList) save() error {
+	if b.filename == "" {
+		return nil
+	}
+	f := banFile{Nicks: []string{}, IPs: []string{}}
+	for n := range b.nicks {
+		f.Nicks = append(f.Nicks, n)
+	}
+	for ip := range b.ips {
+		f.IPs = append(f.IPs, ip)
+	}
+	sort.Strings(f.Nicks)
+	sort.Strings(f.IPs)
+	data, _ := json.MarshalIndent(f, "", "  ")
+	tmp := b.filename + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.filename)
+}
+
+// ban adds a nickname, or an IP address if target is an IP address.
+// It reports whether target is an IP address.
+func (b *banList) ban(target string, add bool) (isIP bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	set := b.nicks
+	if ip := net.ParseIP(target); ip != nil {
+		set, target, isIP = b.ips, ip.String(), true
+	} else {
+		target = strings.ToLower(target)
+	}
+	if add {
+		set[target] = true
+	} else {
+		delete(set, target)
+	}
+	return isIP, b.save()
+}
+
+func (b *banList) bannedNick(nick string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nicks[strings.ToLower(nick)]
+}
+
+func (b *banList) bannedIP(ip string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ips[ip]
+}
+
+// remoteIP returns the IP address of the peer of conn.
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// banListener refuses connections from banned IP addresses.
+type banListener struct {
+	net.Listener
+	bans *banList
+}
+
+func (l banListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.bans.bannedIP(remoteIP(conn)) {
+			return conn, nil
+		}
+		log.Printf("refused banned %s", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+// loadOperators reads the operators from JSON file such as
+//  {"operators": {"alice": "password"}}
+func loadOperators(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var conf struct {
+		Operators map[string]string `json:"operators"`
+	}
+	if err = json.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	ops := map[string]string{}
+	for name, password := range conf.Operators {
+		ops[strings.ToLower(name)] = password
+	}
+	return ops, nil
+}
+
+func equalPassword(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// oper grants the operator role by "/oper password" with the shared
+// password, or "/oper name password" with the operators file.
+func (h *hub) oper(cli *client, arg string) {
+	f := strings.Fields(arg)
+	ok := false
+	switch len(f) {
+	case 1:
+		ok = equalPassword(h.operPassword, f[0])
+	case 2:
+		ok = equalPassword(h.operators[strings.ToLower(f[0])], f[1])
+	}
+	if !ok {
+		send(cli, "Permission denied")
+		return
+	}
+	cli.op = true
+	send(cli, "You are now an operator")
+}
+
+// kick disconnects the target of ev, announcing ev to its rooms. Remote
+// clients and bots are not kicked.
+func (h *hub) kick(target *client, ev event) {
+	if target.Out == nil {
+		return
+	}
+	for _, room := range sortedKeys(target.rooms) {
+		ev.room = room
+		h.broadcast(ev)
+	}
+	send(target, "*** "+ev.describe())
+	target.kicked = true
+	if target.conn != nil {
+		target.conn.Close()
+	}
+}
+
+// moderate executes the commands of operators. It reports whether the
+// command is a moderation command.
+func (h *hub) moderate(cmd command) bool {
+	cli, room := cmd.from, cmd.room
+	if room == "" {
+		room = cli.current
+	}
+	switch cmd.name {
+	case "kick", "ban", "unban", "mute":
+	case "topic":
+		if cmd.arg == "" {
+			h.showTopic(cli, room)
+			return true
+		}
+	default:
+		return false
+	}
+	if !cli.op {
+		reply(cli, "Permission denied: you are not an operator", "482", room, "You're not channel operator")
+		return true
+	}
+	f := strings.Fields(cmd.arg)
+	switch cmd.name {
+	case "kick":
+		if len(f) == 0 {
+			send(cli, "Usage: /kick name [reason]")
+			return true
+		}
+		target := h.nicks[strings.ToLower(f[0])]
+		if target == nil {
+			send(cli, "No such user "+f[0])
+			return true
+		}
+		if target.server != "" {
+			send(cli, target.Name+" is on "+target.server+". Ask its operators.")
+			return true
+		}
+		if target.bot {
+			send(cli, target.Name+" is a bot.")
+			return true
+		}
+		h.kick(target, event{kind: "kick", from: cli, name: cli.Name,
+			target: target.Name, text: strings.Join(f[1:], " ")})
+
+	case "ban", "unban":
+		if len(f) != 1 {
+			send(cli, "Usage: /"+cmd.name+" name|ip")
+			return true
+		}
+		isIP, err := h.bans.ban(f[0], cmd.name == "ban")
+		if err != nil {
+			log.Print(err)
+			send(cli, "Failed to save the ban list")
+		}
+		if cmd.name == "unban" {
+			send(cli, "Unbanned "+f[0])
+			return true
+		}
+		send(cli, "Banned "+f[0])
+		for c := range h.clients {
+			if (isIP && h.bans.bannedIP(c.ip)) || (!isIP && h.bans.bannedNick(c.Name)) {
+				h.kick(c, event{kind: "ban", from: cli, name: cli.Name, target: c.Name})
+			}
+		}
+
+	case "mute":
+		var d time.Duration
+		var err error
+		if len(f) == 2 {
+			d, err = time.ParseDuration(f[1])
+		}
+		if len(f) != 2 || err != nil || d < 0 {
+			send(cli, "Usage: /mute name duration, e.g. /mute bob 10m")
+			return true
+		}
+		target := h.nicks[strings.ToLower(f[0])]
+		if target == nil {
+			send(cli, "No such user "+f[0])
+			return true
+		}
+		if d == 0 {
+			delete(h.mutes, strings.ToLower(target.Name))
+			send(target, "You are unmuted by "+cli.Name)
+			send(cli, target.Name+" is unmuted")
+			return true
+		}
+		h.mutes[strings.ToLower(target.Name)] = time.Now().Add(d)
+		send(target, fmt.Sprintf("You are muted by %s for %v", cli.Name, d))
+		send(cli, fmt.Sprintf("%s is muted for %v", target.Name, d))
+
+	case "topic":
+		if room == "" {
+			send(cli, "You are not in any room.")
+			return true
+		}
+		h.topics[room] = cmd.arg
+		h.broadcast(event{kind: "topic", from: cli, name: cli.Name, room: room, text: cmd.arg})
+	}
+	return true
+}
+
+// muted reports whether cli can't speak now, telling cli the rest.
+func (h *hub) muted(cli *client) bool {
+	until, ok := h.mutes[strings.ToLower(cli.Name)]
+	if !ok {
+		return false
+	}
+	if rest := time.Until(until); rest > 0 {
+		send(cli, fmt.Sprintf("You are muted for another %v", rest.Round(time.Second)))
+		return true
+	}
+	delete(h.mutes, strings.ToLower(cli.Name))
+	return false
+}
+
+// showTopic sends the topic of the room to cli.
+func (h *hub) showTopic(cli *client, room string) {
+	if topic := h.topics[room]; topic != "" {
+		reply(cli, "Topic of "+room+": "+topic, "332", room, topic)
+		return
+	}
+	if room != "" {
+		reply(cli, "No topic is set in "+room, "331", room, "No topic is set")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bans.json")
+	b, err := loadBans(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isIP, err := b.ban("Bob", true); isIP || err != nil {
+		t.Errorf("Result = %v, %v, Expected a nickname", isIP, err)
+	}
+	if isIP, err := b.ban("::ffff:10.0.0.1", true); !isIP || err != nil {
+		t.Errorf("Result = %v, %v, Expected an IP address", isIP, err)
+	}
+	b.ban("carol", true)
+	b.ban("carol", false)
+
+	// The list is restored from the file.
+	b, err = loadBans(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.bannedNick("BOB") || !b.bannedIP("10.0.0.1") || b.bannedNick("carol") {
+		t.Errorf("Result = %v %v, Expected bob and 10.0.0.1", b.nicks, b.ips)
+	}
+}
+
+func TestBanListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	bans, _ := loadBans("")
+	bans.ban("127.0.0.1", true)
+	go banListener{ln, bans}.Accept()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Result = nil, Expected the banned connection to be closed")
+	}
+}
+
+func TestModeration(t *testing.T) {
+	h := newHub(10, 0)
+	h.operPassword = "secret"
+	alice, aliceOut := newTestClient(h, "alice")
+	bob, bobOut := newTestClient(h, "bob")
+	server, peer := net.Pipe()
+	defer peer.Close()
+	bob.conn = server
+
+	h.command(command{from: bob, name: "kick", arg: "alice"})
+	h.command(command{from: alice, name: "oper", arg: "wrong"})
+	h.command(command{from: alice, name: "oper", arg: "secret"})
+	h.command(command{from: alice, name: "topic", arg: "Go 1.7 release party"})
+	h.command(command{from: alice, name: "mute", arg: "bob 1h"})
+	h.say(bob, "", "can I talk?")
+	h.command(command{from: bob, name: "who"})
+	expect := []string{
+		"Permission denied: you are not an operator",
+		"#lobby alice changed the topic to: Go 1.7 release party",
+		"You are muted by alice for 1h0m0s",
+		"You are muted for another 1h0m0s",
+		"Present:\n@alice\nbob",
+	}
+	received(aliceOut)
+	if got := received(bobOut)[1:]; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	h.command(command{from: alice, name: "ban", arg: "bob"})
+	if !bob.kicked {
+		t.Errorf("Result = false, Expected bob to be kicked by the ban")
+	}
+	if got := received(aliceOut); len(got) != 2 || !strings.Contains(got[1], "bob was banned by alice") {
+		t.Errorf("Result = %q, Expected the ban announcement", got)
+	}
+	h.leave(bob)
+	if reason := h.enter(&client{Name: "Bob"}); reason != "Name Bob is banned." {
+		t.Errorf("Result = %q, Expected banned", reason)
+	}
+}
+
+func TestMuteReconnect(t *testing.T) {
+	h := newHub(10, 0)
+	alice, aliceOut := newTestClient(h, "alice")
+	alice.op = true
+	bob, _ := newTestClient(h, "bob")
+	bob.ip = "10.0.0.2"
+	h.command(command{from: alice, name: "mute", arg: "bob 1h"})
+	h.leave(bob)
+	received(aliceOut)
+
+	var tests = []struct {
+		name, ip string
+		muted    bool
+	}{
+		{"Bob", "10.0.0.3", true},     // the same nickname
+		{"robert", "10.0.0.2", false}, // others from the same IP address
+		{"carol", "10.0.0.3", false},
+		{"dave", "", false},
+	}
+	for _, test := range tests {
+		cli, out := newTestClient(h, test.name)
+		cli.ip = test.ip
+		received(out)
+		received(aliceOut)
+		h.say(cli, "", "hello")
+		if got := h.muted(cli); got != test.muted {
+			t.Errorf("muted(%s from %q) = %v, Expected %v", test.name, test.ip, got, test.muted)
+		}
+		if heard := len(received(aliceOut)) != 0; heard == test.muted {
+			t.Errorf("Result = %v, Expected %s to be heard %v", heard, test.name, !test.muted)
+		}
+		h.leave(cli)
+	}
+
+	bob, _ = newTestClient(h, "bob")
+	h.nick(bob, "bobby")
+	if !h.muted(bob) {
+		t.Errorf("Result = false, Expected bob to be muted after /nick")
+	}
+	h.nick(bob, "bob")
+	h.command(command{from: alice, name: "mute", arg: "bob 0"})
+	if h.muted(bob) {
+		t.Errorf("Result = true, Expected bob to be unmuted")
+	}
+}
+
+func TestLoadOperators(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ops.json")
+	os.WriteFile(filename, []byte(`{"operators": {"Alice": "secret"}}`), 0600)
+	ops, err := loadOperators(filename)
+	if err != nil || ops["alice"] != "secret" {
+		t.Errorf("Result = %v, %v, Expected alice", ops, err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// Plugin is notified of the events in all rooms. The methods are called by
+// broadcaster, so they must return quickly; slow work such as I/O should
+// run in Bot.Go. Events caused by bots are not notified.
+type Plugin interface {
+	OnJoin(room, name string)
+	OnLeave(room, name string)
+	OnMessage(room, name, text string)
+}
+
+// Bot is a client run by a plugin. Its methods can be called from any
+// goroutine.
+type Bot struct {
+	Name string
+	cli  *client
+	h    *hub
+}
+
+// Say sends text to the room. The bot joins the room if needed.
+func (b *Bot) Say(room, text string) {
+	b.do(func() {
+		if !validRoom(room) {
+			return
+		}
+		if !b.cli.rooms[room] {
+			b.h.join(b.cli, room)
+		}
+		b.h.say(b.cli, room, text)
+	})
+}
+
+// Join makes the bot a member of the room.
+func (b *Bot) Join(room string) {
+	b.do(func() {
+		if validRoom(room) {
+			b.h.join(b.cli, room)
+		}
+	})
+}
+
+// do runs f by broadcaster. f is dropped if broadcaster is too busy.
+func (b *Bot) do(f func()) {
+	select {
+	case b.h.actions <- f:
+	default:
+		log.Printf("bot %s: too many actions, dropped", b.Name)
+	}
+}
+
+// Go runs f in a new goroutine. A panic of f is logged.
+func (b *Bot) Go(f func()) {
+	go func() {
+		defer logPanic("bot " + b.Name)
+		f()
+	}()
+}
+
+// logPanic recovers from a panic and logs it. It must be deferred.
+func logPanic(who string) {
+	if x := recover(); x != nil {
+		log.Printf("%s panicked: %v\n%s", who, x, debug.Stack())
+	}
+}
+
+// newBot registers a bot client in #lobby.
+func (h *hub) newBot(name string) (*Bot, error) {
+	cli := &client{Name: name, bot: true}
+	if reason := h.enter(cli); reason != "" {
+		return nil, fmt.Errorf("bot %s: %s", name, reason)
+	}
+	h.join(cli, lobby)
+	return &Bot{Name: name, cli: cli, h: h}, nil
+}
+
+// addPlugin registers p to be notified of events.
+func (h *hub) addPlugin(p Plugin) {
+	h.plugins = append(h.plugins, p)
+}
+
+// notify calls the plugins for ev. A panicking plugin is logged, and the
+// others are still called.
+func (h *hub) notify(ev event) {
+	if ev.from != nil && ev.from.bot {
+		return
+	}
+	for _, p := range h.plugins {
+		call(p, ev)
+	}
+}
+
+func call(p Plugin, ev event) {
+	defer logPanic(fmt.Sprintf("plugin %T", p))
+	switch ev.kind {
+	case "join":
+		p.OnJoin(ev.room, ev.name)
+	case "part", "quit":
+		p.OnLeave(ev.room, ev.name)
+	case "say":
+		p.OnMessage(ev.room, ev.name, ev.text)
+	}
+}
+
+// botTypes are the bots enabled by the -bots flag.
+var botTypes = map[string]func(*Bot) Plugin{
+	"echo":  newEchoBot,
+	"calc":  newCalcBot,
+	"title": newTitleBot,
+}
+
+// startBots starts the bots named in the comma separated list such as
+// "echo,calc". The name of each bot client is the type followed by "bot".
+func (h *hub) startBots(list string) error {
+	for _, typ := range strings.Split(list, ",") {
+		typ = strings.TrimSpace(typ)
+		newPlugin := botTypes[typ]
+		if newPlugin == nil {
+			var types []string
+			for t := range botTypes {
+				types = append(types, t)
+			}
+			sort.Strings(types)
+			return fmt.Errorf("unknown bot %q, use %s", typ, strings.Join(types, ", "))
+		}
+		bot, err := h.newBot(typ + "bot")
+		if err != nil {
+			return err
+		}
+		h.addPlugin(newPlugin(bot))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runActions runs the queued actions of bots.
+func runActions(h *hub) {
+	for {
+		select {
+		case f := <-h.actions:
+			f()
+		default:
+			return
+		}
+	}
+}
+
+// panicPlugin panics on every message.
+type panicPlugin struct{ nopPlugin }
+
+func (panicPlugin) OnMessage(room, name, text string) { panic("bad bot") }
+
+func TestBots(t *testing.T) {
+	h := newHub(10, 0)
+	h.addPlugin(panicPlugin{})
+	if err := h.startBots("echo, calc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.startBots("dice"); err == nil {
+		t.Errorf("Result = nil, Expected an error of the unknown bot")
+	}
+	alice, aliceOut := newTestClient(h, "alice")
+	received(aliceOut)
+
+	for _, text := range []string{"!echo hi", "!calc 1 + 2 * 3", "!calc sqrt(x)", "!calc 1 +", "hello"} {
+		h.say(alice, "", text)
+		runActions(h)
+	}
+	got := received(aliceOut)
+	expect := []string{
+		"#lobby alice: !echo hi",
+		"#lobby echobot: hi",
+		"#lobby alice: !calc 1 + 2 * 3",
+		"#lobby calcbot: alice: 1 + 2 * 3 = 7",
+		"#lobby alice: !calc sqrt(x)",
+		"#lobby calcbot: alice: undefined: x",
+		"#lobby alice: !calc 1 +",
+		"#lobby calcbot: alice: unexpected end of file",
+		"#lobby alice: hello",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Result = %q, Expected %q", got, expect)
+	}
+
+	h.command(command{from: alice, name: "who"})
+	if got := received(aliceOut); !reflect.DeepEqual(got, []string{"Present:\nalice\ncalcbot\nechobot"}) {
+		t.Errorf("Result = %q, Expected the bots in #lobby", got)
+	}
+}
+
+func TestTitleBot(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><head><TITLE>\n  Go &amp; Chat\n</TITLE></head></html>")
+	}))
+	defer srv.Close()
+
+	h := newHub(10, 0)
+	bot, err := h.newBot("titlebot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, aliceOut := newTestClient(h, "alice")
+	received(aliceOut)
+
+	// The default client refuses to connect to the test server on
+	// localhost.
+	tb := newTitleBot(bot).(*titleBot)
+	if _, err := tb.title(srv.URL); err == nil || !strings.Contains(err.Error(), errPrivate.Error()) {
+		t.Errorf("Result = %v, Expected %v", err, errPrivate)
+	}
+	tb.client = srv.Client()
+	tb.OnMessage(lobby, "alice", "see "+srv.URL+"/page")
+	select {
+	case f := <-h.actions:
+		f()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Result = timeout, Expected the title")
+	}
+	if got := received(aliceOut); !reflect.DeepEqual(got, []string{"#lobby titlebot: Title: Go & Chat"}) {
+		t.Errorf("Result = %q, Expected the title", got)
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	var tests = []struct {
+		address string
+		expect  bool
+	}{
+		{"93.184.216.34:80", true},
+		{"[2606:2800:220:1::248]:443", true},
+		{"127.0.0.1:8080", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"192.168.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"0.0.0.0:80", false},
+	}
+	for _, test := range tests {
+		if err := publicOnly("tcp", test.address, nil); (err == nil) != test.expect {
+			t.Errorf("publicOnly(%q) = %v, Expected %v", test.address, err, test.expect)
+		}
+	}
+}
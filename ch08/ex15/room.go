@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lobby is the room which every client joins on arrival.
+const lobby = "#lobby"
+
+const usage = "Commands: /join #room, /leave [#room], /rooms, /who [#room], " +
+	"/nick name, /msg name text, /away [reason], /back, /history [N], /topic [text], /help\n" +
+	"Accounts: /register password, /identify password\n" +
+	"Operators: /oper [name] password, /kick name [reason], /ban name|ip, /unban name|ip, /mute name duration"
+
+// hub is the state of broadcaster. It must be used only by broadcaster.
+type hub struct {
+	clients map[*client]bool            // all connected clients
+	nicks   map[string]*client          // clients by the lower case name
+	rooms   map[string]map[*client]bool // members of each room
+
+	history     map[string]*ring // recent messages of each room
+	historySize int              // capacity of history of each room
+	replaySize  int              // number of messages replayed on join
+	log         io.Writer        // append-only log of messages, nil if disabled
+
+	operPassword string               // password of /oper, "" if disabled
+	operators    map[string]string    // passwords of /oper name by the lower case name
+	bans         *banList             // banned nicknames and IP addresses
+	mutes        map[string]time.Time // end of mutes by the lower case nickname
+	topics       map[string]string    // topic of each room
+
+	network *network // links to other servers, nil if not linked
+
+	plugins []Plugin
+	actions chan func() // actions of bots and timers run by broadcaster
+
+	accounts *accountStore      // registered nicknames
+	failures map[string]failure // wrong passwords of /identify by the lower case name
+	guests   int                // number of guest names given
+
+	traffic meter // messages said in rooms and privately
+}
+
+func newHub(historySize, replaySize int) *hub {
+	return &hub{
+		clients:     map[*client]bool{},
+		nicks:       map[string]*client{},
+		rooms:       map[string]map[*client]bool{},
+		history:     map[string]*ring{},
+		historySize: historySize,
+		replaySize:  replaySize,
+		operators:   map[string]string{},
+		bans:        &banList{nicks: map[string]bool{}, ips: map[string]bool{}},
+		mutes:       map[string]time.Time{},
+		topics:      map[string]string{},
+		actions:     make(chan func(), 100),
+		accounts:    &accountStore{accounts: map[string]account{}},
+		failures:    map[string]failure{},
+	}
+}
+
+// validNick reports whether name can be a nickname.
+func validNick(name string) bool {
+	if name == "" || len(name) > 32 || strings.ContainsAny(name[:1], "#/") {
+		return false
+	}
+	return !strings.ContainsAny(name, " \t,:*!@") && !hasControl(name)
+}
+
+// hasControl reports whether s has control characters such as CR, which
+// could end an IRC message.
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0
+}
+
+// enter registers cli. It returns the reason if the name can't be used.
+func (h *hub) enter(cli *client) string {
+	key := strings.ToLower(cli.Name)
+	switch {
+	case !validNick(cli.Name):
+		return "Name " + cli.Name + " is invalid."
+	case h.nicks[key] != nil:
+		return "Name " + cli.Name + " is already used."
+	case h.bans.bannedNick(cli.Name):
+		return "Name " + cli.Name + " is banned."
+	}
+	h.clients[cli] = true
+	h.nicks[key] = cli
+	return ""
+}
+
+// leave unregisters cli.
+func (h *hub) leave(cli *client) {
+	delete(h.clients, cli)
+	delete(h.nicks, strings.ToLower(cli.Name))
+}
+
+// validRoom reports whether name is a room name such as "#go".
+func validRoom(name string) bool {
+	if len(name) < 2 || len(name) > 50 || name[0] != '#' {
+		return false
+	}
+	return !strings.ContainsAny(name, " ,") && !hasControl(name)
+}
+
+// say broadcasts text of cli to the room, the current room if room is "".
+func (h *hub) say(cli *client, room, text string) {
+	if room == "" {
+		room = cli.current
+	}
+	if room == "" {
+		send(cli, "You are not in any room. /join #room")
+		return
+	}
+	if !cli.rooms[room] {
+		reply(cli, "You are not in "+room, "404", room, "Cannot send to channel")
+		return
+	}
+	if h.muted(cli) {
+		return
+	}
+	h.broadcast(event{kind: "say", from: cli, name: cli.Name, room: room, text: text})
+	h.traffic.add(time.Now())
+	h.record(record{Time: time.Now(), Room: room, From: cli.Name, Text: text})
+}
+
+// join makes cli a member of the room and its current room.
+func (h *hub) join(cli *client, room string) {
+	cli.current = room
+	if cli.rooms[room] {
+		if !cli.irc {
+			send(cli, "Now talking in "+room)
+		}
+		return
+	}
+	ev := event{kind: "join", from: cli, name: cli.Name, room: room}
+	h.broadcast(ev)
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*client]bool{}
+	}
+	h.rooms[room][cli] = true
+	if cli.rooms == nil {
+		cli.rooms = map[string]bool{}
+	}
+	cli.rooms[room] = true
+	if cli.irc {
+		deliver(cli, ev)
+		h.names(cli, room)
+	} else {
+		send(cli, "Joined "+room+"\n"+h.present(room))
+	}
+	if h.topics[room] != "" {
+		h.showTopic(cli, room)
+	}
+	h.replay(cli, room, h.replaySize)
+}
+
+// present returns the list of members of the room.
+func (h *hub) present(room string) string {
+	var names []string
+	for c := range h.rooms[room] {
+		name := c.Name
+		if c.op {
+			name = "@" + name
+		}
+		if c.away != "" {
+			name += " (away: " + c.away + ")"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(append([]string{"Present:"}, names...), "\n")
+}
+
+// part removes cli from the room. The current room of cli becomes another
+// joined room if any.
+func (h *hub) part(cli *client, room string) {
+	delete(cli.rooms, room)
+	h.remove(cli, room)
+	h.broadcast(event{kind: "part", from: cli, name: cli.Name, room: room})
+	if cli.current == room {
+		cli.current = ""
+		for _, r := range sortedKeys(cli.rooms) {
+			cli.current = r
+			break
+		}
+	}
+}
+
+// quit removes cli from all its rooms with the reason.
+func (h *hub) quit(cli *client, reason string) {
+	for room := range cli.rooms {
+		h.remove(cli, room)
+	}
+	h.announce(cli, event{kind: "quit", from: cli, name: cli.Name, text: reason})
+	cli.rooms = nil
+	cli.current = ""
+}
+
+// remove deletes cli from the members of the room.
+func (h *hub) remove(cli *client, room string) {
+	delete(h.rooms[room], cli)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// command executes the slash command.
+func (h *hub) command(cmd command) {
+	cli, room := cmd.from, strings.ToLower(cmd.arg)
+	if h.moderate(cmd) {
+		return
+	}
+	switch cmd.name {
+	case "join":
+		if !validRoom(room) {
+			send(cli, "Usage: /join #room")
+			return
+		}
+		h.join(cli, room)
+
+	case "leave":
+		if room == "" {
+			room = cli.current
+		}
+		if room == "" {
+			send(cli, "You are not in any room.")
+			return
+		}
+		if !cli.rooms[room] {
+			send(cli, "You are not in "+room)
+			return
+		}
+		h.part(cli, room)
+		if cli.irc {
+			deliver(cli, event{kind: "part", from: cli, name: cli.Name, room: room})
+			return
+		}
+		msg := "Left " + room
+		if cli.current != "" {
+			msg += ", now talking in " + cli.current
+		}
+		send(cli, msg)
+
+	case "rooms":
+		var lines []string
+		for r := range h.rooms {
+			lines = append(lines, fmt.Sprintf("%s (%d)", r, len(h.rooms[r])))
+		}
+		sort.Strings(lines)
+		send(cli, strings.Join(append([]string{"Rooms:"}, lines...), "\n"))
+
+	case "who":
+		if room == "" {
+			room = cli.current
+		}
+		if cli.irc {
+			h.names(cli, room)
+			return
+		}
+		if h.rooms[room] == nil {
+			send(cli, "No such room "+room)
+			return
+		}
+		send(cli, h.present(room))
+
+	case "nick":
+		h.nick(cli, cmd.arg)
+
+	case "msg":
+		f := strings.SplitN(cmd.arg, " ", 2)
+		if len(f) != 2 || strings.TrimSpace(f[1]) == "" {
+			send(cli, "Usage: /msg name text")
+			return
+		}
+		h.msg(cli, f[0], strings.TrimSpace(f[1]))
+
+	case "away":
+		cli.away = cmd.arg
+		if cli.away == "" {
+			cli.away = "away"
+		}
+		send(cli, "You are marked as away: "+cli.away)
+
+	case "back":
+		cli.away = ""
+		send(cli, "You are back")
+
+	case "history":
+		n := h.replaySize
+		if cmd.arg != "" {
+			var err error
+			if n, err = strconv.Atoi(cmd.arg); err != nil || n <= 0 {
+				send(cli, "Usage: /history [N]")
+				return
+			}
+		}
+		if cli.current == "" {
+			send(cli, "You are not in any room.")
+			return
+		}
+		h.replay(cli, cli.current, n)
+
+	case "oper":
+		h.oper(cli, cmd.arg)
+
+	case "register":
+		h.register(cli, cmd.arg)
+
+	case "identify":
+		h.identify(cli, cmd.arg)
+
+	case "help":
+		send(cli, usage)
+
+	default:
+		reply(cli, "Unknown command /"+cmd.name+". "+usage, "421", strings.ToUpper(cmd.name), "Unknown command")
+	}
+}
+
+// nick renames cli to name and announces it to the rooms of cli.
+func (h *hub) nick(cli *client, name string) {
+	if !validNick(name) {
+		reply(cli, "Usage: /nick name", "432", name, "Erroneous nickname")
+		return
+	}
+	key := strings.ToLower(name)
+	if other := h.nicks[key]; other != nil && other != cli {
+		reply(cli, "Name "+name+" is already used", "433", name, "Nickname is already in use")
+		return
+	}
+	if h.bans.bannedNick(name) {
+		reply(cli, "Name "+name+" is banned", "432", name, "Nickname is banned")
+		return
+	}
+	h.rename(cli, name)
+	h.protect(cli)
+}
+
+// rename changes the name of cli and announces it.
+func (h *hub) rename(cli *client, name string) {
+	ev := event{kind: "nick", from: cli, name: cli.Name, text: name}
+	delete(h.nicks, strings.ToLower(cli.Name))
+	h.nicks[strings.ToLower(name)] = cli
+	// The mute follows cli, so that /nick doesn't end it.
+	if until := h.mutes[strings.ToLower(cli.Name)]; until.After(h.mutes[strings.ToLower(name)]) {
+		h.mutes[strings.ToLower(name)] = until
+	}
+	cli.Name = name
+	h.announce(cli, ev)
+	if len(cli.rooms) == 0 {
+		if cli.irc {
+			deliver(cli, ev)
+		} else {
+			send(cli, "You are now known as "+name)
+		}
+	}
+}
+
+// msg sends the private message of cli to the client named to.
+func (h *hub) msg(cli *client, to, text string) {
+	target := h.nicks[strings.ToLower(to)]
+	if target == nil {
+		reply(cli, "No such user "+to, "401", to, "No such nick/channel")
+		return
+	}
+	if h.muted(cli) {
+		return
+	}
+	ev := event{kind: "msg", from: cli, name: cli.Name, target: target.Name, text: text}
+	deliver(target, ev)
+	h.forward(ev)
+	h.traffic.add(time.Now())
+	if cli.irc {
+		if target.away != "" {
+			sendRaw(cli, numeric(cli.Name, "301", target.Name, target.away))
+		}
+		return
+	}
+	msg := "-> *" + target.Name + "* " + text
+	if target.away != "" {
+		msg += "\n" + target.Name + " is away: " + target.away
+	}
+	send(cli, msg)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// serveWeb serves the chat page and WebSocket clients on ln.
+func serveWeb(ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrade(w, r)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		handleConn(conn)
+	})
+	return http.Serve(ln, mux)
+}
+
+// page is the chat client for browsers.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; flex-direction: column; height: 100vh; }
+#log { flex: 1; overflow-y: auto; margin: 0; padding: 8px; white-space: pre-wrap; }
+form { display: flex; padding: 8px; border-top: 1px solid #ccc; }
+#input { flex: 1; }
+</style>
+</head>
+<body>
+<pre id="log"></pre>
+<form id="form"><input id="input" autocomplete="off" autofocus><button>Send</button></form>
+<script>
+var log = document.getElementById("log");
+var input = document.getElementById("input");
+function show(text) {
+  var atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+  log.appendChild(document.createTextNode(text + "\n"));
+  if (atBottom) {
+    log.scrollTop = log.scrollHeight;
+  }
+}
+var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+var ws = new WebSocket(scheme + location.host + "/ws");
+ws.onmessage = function(e) { show(e.data); };
+ws.onclose = function() { show("*** Disconnected"); input.disabled = true; };
+document.getElementById("form").onsubmit = function(e) {
+  e.preventDefault();
+  if (input.value !== "" && ws.readyState === WebSocket.OPEN) {
+    ws.send(input.value);
+  }
+  input.value = "";
+};
+</script>
+</body>
+</html>
+`
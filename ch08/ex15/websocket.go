@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is the GUID to compute Sec-WebSocket-Accept in RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxPayload limits the size of a message from WebSocket clients.
+const maxPayload = 64 << 10
+
+// opcodes of WebSocket frames.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+var errProtocol = errors.New("websocket: protocol error")
+
+// wsConn is a WebSocket connection which reads and writes lines like a TCP
+// connection of the chat, so that handleConn can serve it. Each text
+// message read ends with "\n", and each Write is sent as a text message.
+type wsConn struct {
+	net.Conn
+	r    *bufio.Reader
+	wmu  sync.Mutex // serializes frames written by clientWriter and pongs
+	buf  []byte     // rest of the message being read
+	done bool       // close frame has been received
+}
+
+// acceptKey returns Sec-WebSocket-Accept for Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains reports whether the comma separated header has token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgrade performs the opening handshake of RFC 6455.
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, errProtocol
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errProtocol
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket is not supported", http.StatusInternalServerError)
+		return nil, errProtocol
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+acceptKey(key)+"\r\n\r\n")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{Conn: conn, r: rw.Reader}, nil
+}
+
+// Read reads the text of messages, ending each message with "\n".
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		msg, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.buf = append(msg, '\n')
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// readMessage reads frames until a data message completes. Control frames
+// are handled in between.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err = c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.done = true
+			c.writeFrame(opClose, payload) // echo the status code
+			if len(msg) > 0 {
+				return msg, nil
+			}
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, c.fail()
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, c.fail()
+			}
+		default:
+			return nil, c.fail()
+		}
+		if len(msg)+len(payload) > maxPayload {
+			return nil, c.fail()
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads a frame from the client.
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.r, h[:]); err != nil {
+		return
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0f
+	if h[0]&0x70 != 0 || h[1]&0x80 == 0 {
+		// Reserved bits must be zero, and clients must mask frames.
+		return false, 0, nil, c.fail()
+	}
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.r, b[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.r, b[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if n > maxPayload || (op >= opClose && (n > 125 || !fin)) {
+		return false, 0, nil, c.fail()
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// fail closes the connection with status 1002 (protocol error).
+func (c *wsConn) fail() error {
+	c.writeFrame(opClose, []byte{0x03, 0xea})
+	c.Conn.Close()
+	return errProtocol
+}
+
+// Write sends p without the trailing newline as a text message.
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opText, []byte(strings.TrimSuffix(string(p), "\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame writes an unmasked frame with FIN.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	h := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		h[1] = byte(n)
+	case n <= 0xffff:
+		h[1] = 126
+		h = append(h, byte(n>>8), byte(n))
+	default:
+		h[1] = 127
+		h = binary.BigEndian.AppendUint64(h, uint64(n))
+	}
+	_, err := c.Conn.Write(append(h, payload...))
+	return err
+}
+
+// Close sends the close frame and closes the connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(opClose, []byte{0x03, 0xe8}) // 1000 normal closure
+	return c.Conn.Close()
+}
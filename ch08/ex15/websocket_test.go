@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example of RFC 6455 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Result = %q, Expected %q", got, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+}
+
+// writeClientFrame writes a masked frame like a browser.
+func writeClientFrame(w io.Writer, fin bool, op byte, payload string) {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	w.Write(frame)
+}
+
+// readServerFrame reads an unmasked frame with a short payload.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, string) {
+	t.Helper()
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(h[1])
+	if n == 126 {
+		var b [2]byte
+		io.ReadFull(r, b[:])
+		n = int(b[0])<<8 | int(b[1])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return h[0] & 0x0f, string(payload)
+}
+
+func TestWebSocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Echo the lines read from the client.
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			fmt.Fprintln(conn, "echo: "+s.Text())
+		}
+	}))
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Result = %v, %v, Expected 400 without upgrade", resp, err)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Result = %v, Expected 101 with the accept key", resp)
+	}
+
+	writeClientFrame(conn, true, opText, "hello")
+	if op, s := readServerFrame(t, r); op != opText || s != "echo: hello" {
+		t.Errorf("Result = %d %q, Expected text %q", op, s, "echo: hello")
+	}
+	// A fragmented message with a ping in between.
+	writeClientFrame(conn, false, opText, "wor")
+	writeClientFrame(conn, true, opPing, "p")
+	writeClientFrame(conn, true, opContinuation, "ld")
+	if op, s := readServerFrame(t, r); op != opPong || s != "p" {
+		t.Errorf("Result = %d %q, Expected pong %q", op, s, "p")
+	}
+	if op, s := readServerFrame(t, r); op != opText || s != "echo: world" {
+		t.Errorf("Result = %d %q, Expected text %q", op, s, "echo: world")
+	}
+	writeClientFrame(conn, true, opClose, "\x03\xe8")
+	if op, _ := readServerFrame(t, r); op != opClose {
+		t.Errorf("Result = %d, Expected close", op)
+	}
+}